@@ -0,0 +1,221 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// errNotRecorded is returned when replaying a request the cassette
+// lacks.
+var errNotRecorded = errors.New("not in recording")
+
+// cassetteEntry is one recorded HTTP exchange, written as a line of
+// JSON, with the body base64-encoded by encoding/json. Method may be
+// left out of hand-written cassettes and defaults to GET.
+type cassetteEntry struct {
+	Method        string      `json:"method"`
+	URL           string      `json:"url"`
+	RequestHeader http.Header `json:"request_header,omitempty"`
+	StatusCode    int         `json:"status"`
+	Header        http.Header `json:"header,omitempty"`
+	Body          []byte      `json:"body,omitempty"`
+	Truncated     bool        `json:"truncated,omitempty"` // Body ran past the recording cap and may be cut short
+	Error         string      `json:"error,omitempty"`
+}
+
+// redactedHeaders and redactedResponseHeaders are never written to a
+// cassette.
+var (
+	redactedHeaders         = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+	redactedResponseHeaders = []string{"Set-Cookie"}
+)
+
+func cassetteKey(method, url string) string {
+	return method + " " + url
+}
+
+// RecordingTransport passes requests to next and appends every request
+// and response, or transport error, to a cassette file.
+type RecordingTransport struct {
+	next    http.RoundTripper
+	maxBody int64
+
+	mu  sync.Mutex
+	f   *os.File
+	buf *bufio.Writer
+}
+
+// NewRecordingTransport creates the cassette at path, replacing any
+// file already there. Each response body is recorded up to maxBody+1
+// bytes, and held in memory while recording; 0 means no cap. That is
+// what a fetch with a maxBody cap reads, so a replay truncates a page
+// exactly as the live crawl did. Close it when the crawl is done.
+func NewRecordingTransport(next http.RoundTripper, path string, maxBody int64) (*RecordingTransport, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordingTransport{next: next, maxBody: maxBody, f: f, buf: bufio.NewWriter(f)}, nil
+}
+
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	entry := cassetteEntry{
+		Method:        req.Method,
+		URL:           req.URL.String(),
+		RequestHeader: req.Header.Clone(),
+	}
+	for _, h := range redactedHeaders {
+		entry.RequestHeader.Del(h)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		entry.Error = err.Error()
+		t.write(entry)
+		return nil, err
+	}
+
+	// Read the part of the body to record, then hand the caller all of
+	// it: what was read followed by whatever is left.
+	var body io.Reader = resp.Body
+	if t.maxBody > 0 {
+		body = io.LimitReader(resp.Body, t.maxBody+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		resp.Body.Close()
+		entry.Error = err.Error()
+		t.write(entry)
+		return nil, err
+	}
+	resp.Body = readCloser{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+
+	entry.StatusCode = resp.StatusCode
+	entry.Header = resp.Header.Clone()
+	for _, h := range redactedResponseHeaders {
+		entry.Header.Del(h)
+	}
+	entry.Body = data
+	entry.Truncated = t.maxBody > 0 && int64(len(data)) > t.maxBody
+	t.write(entry)
+	return resp, nil
+}
+
+// readCloser reads from one place and closes another.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func (t *RecordingTransport) write(e cassetteEntry) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.buf.Write(data)
+	t.buf.WriteByte('\n')
+}
+
+// Close flushes and closes the cassette file.
+func (t *RecordingTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.buf.Flush(); err != nil {
+		t.f.Close()
+		return err
+	}
+	return t.f.Close()
+}
+
+// ReplayTransport answers requests from a cassette without touching the
+// network. Repeated requests for the same URL get the recorded
+// responses in order; the last one repeats.
+type ReplayTransport struct {
+	mu      sync.Mutex
+	entries map[string][]cassetteEntry
+	served  map[string]int
+}
+
+// NewReplayTransport loads the cassette at path.
+func NewReplayTransport(path string) (*ReplayTransport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t := &ReplayTransport{
+		entries: make(map[string][]cassetteEntry),
+		served:  make(map[string]int),
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e cassetteEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if e.Method == "" {
+			e.Method = http.MethodGet
+		}
+		key := cassetteKey(e.Method, e.URL)
+		t.entries[key] = append(t.entries[key], e)
+	}
+	return t, scanner.Err()
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	key := cassetteKey(req.Method, req.URL.String())
+	t.mu.Lock()
+	list := t.entries[key]
+	n := t.served[key]
+	t.served[key]++
+	t.mu.Unlock()
+
+	if len(list) == 0 {
+		return nil, fmt.Errorf("replay %s: %w", key, errNotRecorded)
+	}
+	e := list[min(n, len(list)-1)]
+	if e.Error != "" {
+		return nil, errors.New(e.Error)
+	}
+
+	header := e.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,138 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<a href="/about">about</a>`)
+		case "/about":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, "about us")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	path := filepath.Join(t.TempDir(), "crawl.cassette")
+	rec, err := NewRecordingTransport(ts.Client().Transport, path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crawlWith := func(rt http.RoundTripper) []Result {
+		client := &http.Client{Transport: rt}
+		cfg := Config{Seeds: []string{ts.URL + "/"}, Workers: 2, MaxDepth: 1, UserAgent: "gocrawler/1.0"}
+		var results []Result
+		cfg.Client = client
+		New(cfg).Run(context.Background(), func(r Result) {
+			results = append(results, r)
+		})
+		return results
+	}
+
+	recorded := crawlWith(rec)
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// From here on the network is gone.
+	ts.Close()
+
+	rep, err := NewReplayTransport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := crawlWith(rep)
+
+	if len(recorded) != 2 || len(replayed) != 2 {
+		t.Fatalf("got %d recorded and %d replayed results, want 2 each", len(recorded), len(replayed))
+	}
+	for _, r := range replayed {
+		if r.Err != nil || r.Page.StatusCode != http.StatusOK {
+			t.Errorf("%s: got err=%v page=%+v", r.URL, r.Err, r.Page)
+		}
+	}
+
+	// Requests the cassette never saw fail instead of going out.
+	_, err = rep.RoundTrip(httptest.NewRequest(http.MethodGet, ts.URL+"/elsewhere", nil))
+	if !errors.Is(err, errNotRecorded) {
+		t.Errorf("got %v want errNotRecorded", err)
+	}
+
+	// The replay Fetcher reads the same file.
+	f, err := NewReplayFetcher(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page, err := f.Fetch(context.Background(), ts.URL+"/about"); err != nil || string(page.Body) != "about us" {
+		t.Errorf("replayFetcher: got %v, %v", page, err)
+	}
+}
+
+func TestCassetteRecording(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cret"})
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, "0123456789abcdef")
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "crawl.cassette")
+	rec, err := NewRecordingTransport(ts.Client().Transport, path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: rec}
+	resp, err := client.Get(ts.URL + "/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "0123456789abcdef" {
+		t.Errorf("caller got %q, want the whole body", body)
+	}
+	// A link check's HEAD request comes after the GET in the cassette.
+	resp, err = client.Head(ts.URL + "/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("s3cret")) {
+		t.Errorf("cassette holds the session cookie: %s", data)
+	}
+
+	// Replayed with the cap it was recorded with, the page is cut off
+	// just as it was live.
+	f, err := NewReplayFetcher(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := f.Fetch(context.Background(), ts.URL+"/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(page.Body) != "0123456789" || !page.Truncated {
+		t.Errorf("replayed %q truncated=%v, want the first 10 bytes of the GET", page.Body, page.Truncated)
+	}
+}
@@ -0,0 +1,100 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Counters are the running totals saved with a checkpoint so a resumed
+// crawl reports totals for the whole crawl.
+type Counters struct {
+	Fetched int `json:"fetched"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+func (c *Counters) add(r Result) {
+	switch {
+	case r.Err != nil:
+		c.Failed++
+	case r.Skipped != "":
+		c.Skipped++
+	default:
+		c.Fetched++
+	}
+}
+
+// Checkpoint is the on-disk state of an unfinished crawl.
+type Checkpoint struct {
+	Version  int       `json:"version"`
+	SavedAt  time.Time `json:"saved_at"`
+	Seeds    []string  `json:"seeds"`
+	Pending  []Job     `json:"pending"` // queued and in-flight URLs
+	Visited  []string  `json:"visited"`
+	Counters Counters  `json:"counters"`
+}
+
+const checkpointVersion = 1
+
+// saveCheckpoint writes cp to path atomically: it writes a temporary
+// file next to path and renames it, so a crash mid-write never leaves a
+// truncated checkpoint behind.
+func saveCheckpoint(path string, cp *Checkpoint) error {
+	cp.Version = checkpointVersion
+	cp.SavedAt = time.Now().UTC()
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(cp); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadCheckpoint reads a checkpoint written by saveCheckpoint.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	if cp.Version != checkpointVersion {
+		return nil, fmt.Errorf("checkpoint %s: unsupported version %d", path, cp.Version)
+	}
+	return &cp, nil
+}
+
+// newCheckpoint captures the coordinator's state.
+func newCheckpoint(seeds []string, queue []Job, inflight map[string]Job, visited *visitedSet, totals Counters) *Checkpoint {
+	cp := &Checkpoint{
+		Seeds:    seeds,
+		Pending:  make([]Job, 0, len(queue)+len(inflight)),
+		Visited:  visited.List(),
+		Counters: totals,
+	}
+	// In-flight jobs go first: they were dequeued earliest.
+	for _, j := range inflight {
+		cp.Pending = append(cp.Pending, j)
+	}
+	sort.Slice(cp.Pending, func(i, j int) bool { return cp.Pending[i].URL < cp.Pending[j].URL })
+	cp.Pending = append(cp.Pending, queue...)
+	return cp
+}
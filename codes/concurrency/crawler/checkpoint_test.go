@@ -0,0 +1,33 @@
+package crawler
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	visited := newVisitedSet()
+	visited.Add("https://example.com/")
+	visited.Add("https://example.com/a")
+	visited.Add("https://example.com/b")
+
+	queue := []Job{{URL: "https://example.com/b", Depth: 1, Parent: "https://example.com/"}}
+	inflight := map[string]Job{"https://example.com/a": {URL: "https://example.com/a", Depth: 1}}
+	cp := newCheckpoint([]string{"https://example.com/"}, queue, inflight, visited, Counters{Fetched: 1})
+
+	path := filepath.Join(t.TempDir(), "crawl.json")
+	if err := saveCheckpoint(path, cp); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Pending) != 2 || got.Pending[0].URL != "https://example.com/a" || got.Pending[1].Parent != "https://example.com/" {
+		t.Errorf("got pending %+v", got.Pending)
+	}
+	if len(got.Visited) != 3 || got.Counters.Fetched != 1 || len(got.Seeds) != 1 {
+		t.Errorf("got %+v", got)
+	}
+}
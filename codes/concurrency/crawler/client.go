@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultTimeout bounds each request made by the client newClient
+// builds when Config.Client is nil, so a stalled server can't hold a
+// worker forever.
+const defaultTimeout = 30 * time.Second
+
+// BasicAuth is a username and password sent with every request to a
+// host listed in Config.Auth.
+type BasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// newClient returns the client the HTTP fetcher uses: a copy of
+// cfg.Client, or a new client with defaultTimeout, with cfg's proxy,
+// cookie jar and redirect policy applied.
+func newClient(cfg Config) *http.Client {
+	client := &http.Client{Timeout: defaultTimeout}
+	if cfg.Client != nil {
+		*client = *cfg.Client
+	}
+
+	if cfg.Proxy != nil {
+		// Only a plain transport can be pointed at a proxy; callers with
+		// their own RoundTripper configure the proxy on it themselves.
+		var t *http.Transport
+		switch rt := client.Transport.(type) {
+		case nil:
+			t = http.DefaultTransport.(*http.Transport).Clone()
+		case *http.Transport:
+			t = rt.Clone()
+		}
+		if t != nil {
+			t.Proxy = http.ProxyURL(cfg.Proxy)
+			client.Transport = t
+		}
+	}
+	if cfg.Cookies && client.Jar == nil {
+		// cookiejar.New only fails on bad options, and we pass none.
+		client.Jar, _ = cookiejar.New(nil)
+	}
+	if cfg.MaxRedirects != 0 || cfg.SameHostRedirects {
+		client.CheckRedirect = redirectPolicy(cfg.MaxRedirects, cfg.SameHostRedirects)
+	}
+	return client
+}
+
+// redirectPolicy follows at most max redirects (none if max is negative)
+// and, with sameHost, only those that stay on the host first requested.
+// A redirect it won't follow is not an error: the 3xx response becomes
+// the page, and the worker queues its Location like any other link.
+func redirectPolicy(max int, sameHost bool) func(*http.Request, []*http.Request) error {
+	if max == 0 {
+		max = 10 // what net/http allows by default
+	}
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > max {
+			return http.ErrUseLastResponse
+		}
+		if sameHost && !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+}
+
+// redirectTarget returns the absolute Location of a redirect that was
+// not followed, or "" if page isn't one.
+func redirectTarget(page *Page) string {
+	switch page.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return ""
+	}
+	base, err := url.Parse(page.FinalURL)
+	if err != nil {
+		return ""
+	}
+	a, ok := resolveAnchor(base, page.Header.Get("Location"))
+	if !ok {
+		return ""
+	}
+	return a.URL
+}
+
+// authFor returns the credentials for the host of req, looked up with
+// its port first and then without.
+func authFor(auth map[string]BasicAuth, req *http.Request) (BasicAuth, bool) {
+	if a, ok := auth[strings.ToLower(req.URL.Host)]; ok {
+		return a, true
+	}
+	a, ok := auth[strings.ToLower(req.URL.Hostname())]
+	return a, ok
+}
@@ -0,0 +1,154 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFetchHeadersAndAuth(t *testing.T) {
+	var got http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	c := New(Config{
+		UserAgent: "gocrawler/1.0",
+		Header:    http.Header{"Accept-Language": {"en"}, "User-Agent": {"ignored"}},
+		Auth:      map[string]BasicAuth{host: {"crawler", "s3cret"}},
+		Client:    ts.Client(),
+	})
+	if _, err := c.fetcher.Fetch(context.Background(), ts.URL+"/"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ua := got.Get("User-Agent"); ua != "gocrawler/1.0" {
+		t.Errorf("User-Agent = %q", ua)
+	}
+	if lang := got.Get("Accept-Language"); lang != "en" {
+		t.Errorf("Accept-Language = %q", lang)
+	}
+	req := &http.Request{Header: got}
+	if user, pass, ok := req.BasicAuth(); !ok || user != "crawler" || pass != "s3cret" {
+		t.Errorf("basic auth = %q %q %v", user, pass, ok)
+	}
+}
+
+func TestNewClientTimeout(t *testing.T) {
+	if got := newClient(Config{}).Timeout; got != defaultTimeout {
+		t.Errorf("default client timeout = %v want %v", got, defaultTimeout)
+	}
+	// A caller's client is used as it is.
+	if got := newClient(Config{Client: &http.Client{}}).Timeout; got != 0 {
+		t.Errorf("caller's client timeout = %v want 0", got)
+	}
+}
+
+func TestFetchCookies(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+			return
+		}
+		if c, err := r.Cookie("session"); err != nil || c.Value != "abc" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer ts.Close()
+
+	for _, cookies := range []bool{false, true} {
+		c := New(Config{Cookies: cookies, Client: ts.Client()})
+		if _, err := c.fetcher.Fetch(context.Background(), ts.URL+"/login"); err != nil {
+			t.Fatal(err)
+		}
+		page, err := c.fetcher.Fetch(context.Background(), ts.URL+"/private")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[bool]int{false: 403, true: 200}[cookies]; page.StatusCode != want {
+			t.Errorf("cookies=%v: got %d want %d", cookies, page.StatusCode, want)
+		}
+	}
+}
+
+func TestFetchRedirectPolicy(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		switch _, err := fmt.Sscanf(r.URL.Path, "/hop/%d", &n); {
+		case r.URL.Path == "/away":
+			http.Redirect(w, r, other.URL+"/landing", http.StatusFound)
+		case err == nil && n > 0:
+			http.Redirect(w, r, fmt.Sprintf("/hop/%d", n-1), http.StatusMovedPermanently)
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		url      string
+		status   int
+		location string
+	}{
+		{"default follows", Config{}, "/hop/3", 200, ""},
+		{"max hops", Config{MaxRedirects: 2}, "/hop/3", 301, ts.URL + "/hop/0"},
+		{"no redirects", Config{MaxRedirects: -1}, "/hop/3", 301, ts.URL + "/hop/2"},
+		{"cross host allowed", Config{}, "/away", 200, ""},
+		{"same host only", Config{SameHostRedirects: true}, "/away", 302, other.URL + "/landing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Client = ts.Client()
+			c := New(tt.cfg)
+			page, err := c.fetcher.Fetch(context.Background(), ts.URL+tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.StatusCode != tt.status || redirectTarget(page) != tt.location {
+				t.Errorf("got %d to %q, want %d to %q", page.StatusCode, redirectTarget(page), tt.status, tt.location)
+			}
+		})
+	}
+}
+
+func TestFetchProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	c := New(Config{Proxy: proxyURL})
+	if _, err := c.fetcher.Fetch(context.Background(), "http://site.test/page"); err != nil {
+		t.Fatal(err)
+	}
+	if proxied != "http://site.test/page" {
+		t.Errorf("proxy got %q", proxied)
+	}
+}
+
+func TestCrawlFollowsUnfollowedRedirect(t *testing.T) {
+	f := newFakeFetcher(map[string][]fakeResponse{
+		site + "/":    fakeHTML(`<a href="/old">old</a>`),
+		site + "/old": {{Status: http.StatusMovedPermanently, Header: http.Header{"Location": {"/new"}}}},
+		site + "/new": fakeHTML(`new`),
+	})
+
+	var results []Result
+	newTestCrawler(Config{MaxDepth: 2, IgnoreRobots: true}, f).Run(context.Background(), func(r Result) {
+		results = append(results, r)
+	})
+	want := []string{site + "/", site + "/new", site + "/old"}
+	if got := crawledURLs(results); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// loadConfig sets flags from a JSON config file: an object keyed by flag
+// name, with the value a flag would take on the command line.
+//
+//	{
+//		"depth": 3,
+//		"timeout": "10s",
+//		"cookies": true,
+//		"header": ["Accept-Language: en"],
+//		"auth": ["intranet.example=crawler:s3cret"]
+//	}
+//
+// An array sets a repeatable flag once per element. Flags already given
+// on the command line are left alone, so they override the file.
+func loadConfig(fs *flag.FlagSet, name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	// Go through the keys in order so errors are reproducible.
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if fs.Lookup(k) == nil || k == "config" {
+			return fmt.Errorf("%s: unknown setting %q", name, k)
+		}
+		if set[k] {
+			continue
+		}
+		values, err := configValues(settings[k])
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", name, k, err)
+		}
+		for _, v := range values {
+			if err := fs.Set(k, v); err != nil {
+				return fmt.Errorf("%s: %s: %w", name, k, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValues turns a config file value into flag arguments: strings
+// are used as they are, numbers and booleans as written, and an array
+// gives one argument per element.
+func configValues(raw json.RawMessage) ([]string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '[' {
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return nil, err
+		}
+		var values []string
+		for _, e := range elems {
+			v, err := configValue(e)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+	v, err := configValue(raw)
+	if err != nil {
+		return nil, err
+	}
+	return []string{v}, nil
+}
+
+func configValue(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	switch {
+	case len(raw) == 0:
+		return "", fmt.Errorf("missing value")
+	case raw[0] == '"':
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	case raw[0] == '{' || raw[0] == '[' || string(raw) == "null":
+		return "", fmt.Errorf("want a string, number or boolean, got %s", raw)
+	default:
+		return string(raw), nil
+	}
+}
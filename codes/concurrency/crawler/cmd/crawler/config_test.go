@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, config string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "crawler.json")
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseFlagsConfig(t *testing.T) {
+	path := writeConfig(t, `{
+		"depth": 3,
+		"workers": 2,
+		"timeout": "10s",
+		"cookies": true,
+		"cross-host-redirects": false,
+		"header": ["Accept-Language: en", "X-Team: search"],
+		"auth": ["intranet.example=crawler:s3cret"]
+	}`)
+
+	opts, err := parseFlags([]string{"-config", path, "-workers", "5", "https://a.example"}, strings.NewReader(""), io.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.MaxDepth != 3 || opts.Timeout != 10*time.Second || !opts.Cookies || !opts.SameHostRedirects {
+		t.Errorf("got depth=%d timeout=%v cookies=%v same-host=%v", opts.MaxDepth, opts.Timeout, opts.Cookies, opts.SameHostRedirects)
+	}
+	if opts.Workers != 5 {
+		t.Errorf("got %d workers; the command line should win", opts.Workers)
+	}
+	if len(opts.Header) != 2 || opts.Auth["intranet.example"].Password != "s3cret" {
+		t.Errorf("got header %v auth %v", opts.Header, opts.Auth)
+	}
+}
+
+func TestParseFlagsConfigErrors(t *testing.T) {
+	for _, config := range []string{
+		`{"depth": 3`,
+		`{"no-such-flag": 1}`,
+		`{"depth": "deep"}`,
+		`{"depth": {"max": 3}}`,
+		`{"config": "other.json"}`,
+	} {
+		path := writeConfig(t, config)
+		if _, err := parseFlags([]string{"-config", path, "https://a.example"}, strings.NewReader(""), io.Discard); err == nil {
+			t.Errorf("config %s should fail", config)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/foyez/golang/codes/concurrency/crawler"
+)
+
+// options is everything the command line controls: the crawl itself
+// plus how results are reported.
+type options struct {
+	crawler.Config
+
+	Timeout     time.Duration // per request, including the body
+	Grace       time.Duration // how long in-flight requests get after an interrupt
+	Format      string        // result output format
+	Output      string        // file to write results to; stdout if empty
+	MaxErrors   int           // exit non-zero above this many errors; -1 disables
+	ResumeCrawl bool          // continue from CheckpointFile
+	Progress    time.Duration // print a progress line this often; 0 disables
+	LinkCheck   bool          // report broken links instead of every result
+	Graph       bool          // write the link graph instead of every result
+
+	MetricsAddr string // serve Prometheus metrics on this address
+	Record      string // write every HTTP exchange to this cassette
+	Replay      string // answer requests from this cassette, offline
+	CacheDir    string // keep an HTTP cache for conditional requests here
+}
+
+// regexpList is a repeatable flag of regular expressions.
+type regexpList []*regexp.Regexp
+
+func (l *regexpList) String() string {
+	var parts []string
+	for _, re := range *l {
+		parts = append(parts, re.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (l *regexpList) Set(s string) error {
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, re)
+	return nil
+}
+
+// stringList is a repeatable flag of plain strings.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ", ") }
+func (l *stringList) Set(s string) error { *l = append(*l, s); return nil }
+
+// headerList is a repeatable flag of "Name: value" request headers.
+type headerList http.Header
+
+func (h *headerList) String() string {
+	var parts []string
+	for k, vs := range *h {
+		for _, v := range vs {
+			parts = append(parts, k+": "+v)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (h *headerList) Set(s string) error {
+	name, value, ok := strings.Cut(s, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("header %q is not of the form Name: value", s)
+	}
+	if *h == nil {
+		*h = make(headerList)
+	}
+	http.Header(*h).Add(name, strings.TrimSpace(value))
+	return nil
+}
+
+// authList is a repeatable flag of host=user:password credentials.
+type authList map[string]crawler.BasicAuth
+
+func (l *authList) String() string {
+	var hosts []string
+	for host, a := range *l {
+		hosts = append(hosts, host+"="+a.Username+":***")
+	}
+	return strings.Join(hosts, ", ")
+}
+
+func (l *authList) Set(s string) error {
+	host, cred, ok := strings.Cut(s, "=")
+	user, pass, ok2 := strings.Cut(cred, ":")
+	if !ok || !ok2 || host == "" || user == "" {
+		return fmt.Errorf("auth %q is not of the form host=user:password", s)
+	}
+	if *l == nil {
+		*l = make(authList)
+	}
+	(*l)[strings.ToLower(host)] = crawler.BasicAuth{Username: user, Password: pass}
+	return nil
+}
+
+// proxyURL is a flag holding an http, https or socks5 proxy URL.
+type proxyURL struct{ u **url.URL }
+
+func (p proxyURL) String() string {
+	if p.u == nil || *p.u == nil {
+		return ""
+	}
+	return (*p.u).Redacted()
+}
+
+func (p proxyURL) Set(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("proxy %q must be an http, https or socks5 URL", s)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("proxy %q has no host", s)
+	}
+	*p.u = u
+	return nil
+}
+
+// linkCheckFormats are the -format values the linkcheck report supports.
+var linkCheckFormats = []string{"text", "jsonl"}
+
+// parseFlags reads the command line. Seeds come from the positional
+// arguments and, with -seeds, from a file ("-" reads stdin). A leading
+// "linkcheck" or "graph" argument switches to link checking or to
+// writing the link graph; both crawl the whole site, without a depth or
+// page limit unless one is given.
+func parseFlags(args []string, stdin io.Reader, stderr io.Writer) (options, error) {
+	opts := options{
+		Config: crawler.Config{
+			MaxBodySize:    2 << 20,
+			HostBurst:      2,
+			RetryBaseDelay: 500 * time.Millisecond,
+			RetryMaxDelay:  10 * time.Second,
+		},
+	}
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "linkcheck":
+			opts.LinkCheck = true
+			opts.CheckLinks = true
+			args = args[1:]
+		case "graph":
+			opts.Graph = true
+			args = args[1:]
+		}
+	}
+
+	fs := flag.NewFlagSet("crawler", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: crawler [flags] [seed-url ...]\n")
+		fmt.Fprintf(stderr, "       crawler linkcheck [flags] [seed-url ...]\n")
+		fmt.Fprintf(stderr, "       crawler graph [flags] [seed-url ...]\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	configFile := fs.String("config", "", "read flag values from JSON `file`; the command line takes precedence")
+	seedsFile := fs.String("seeds", "", "read seed URLs from `file`, one per line (- for stdin)")
+	fs.IntVar(&opts.Workers, "workers", 3, "number of concurrent workers")
+	fs.IntVar(&opts.MinWorkers, "min-workers", 1, "with -max-workers, never scale below this many workers")
+	fs.IntVar(&opts.MaxWorkers, "max-workers", 0, "scale the pool between -min-workers and this many workers (0 for a fixed pool)")
+	fs.DurationVar(&opts.ScaleLatency, "scale-latency", time.Second, "with -max-workers, add workers only while fetches are faster than this")
+	fs.DurationVar(&opts.Timeout, "timeout", 5*time.Second, "per-request timeout")
+	fs.DurationVar(&opts.Timeouts.Connect, "connect-timeout", 0, "limit for establishing a connection (0 for none)")
+	fs.DurationVar(&opts.Timeouts.TLS, "tls-timeout", 0, "limit for the TLS handshake (0 for none)")
+	fs.DurationVar(&opts.Timeouts.FirstByte, "ttfb-timeout", 0, "limit from sending a request to the first response byte (0 for none)")
+	fs.DurationVar(&opts.Timeouts.Body, "body-timeout", 0, "limit for reading a response body (0 for none)")
+	fs.DurationVar(&opts.Deadline, "deadline", 0, "stop the whole crawl after this long (0 for no limit)")
+	fs.Int64Var(&opts.MaxBytes, "max-bytes", 0, "stop the crawl after downloading this many body bytes (0 for no limit)")
+	fs.DurationVar(&opts.Grace, "grace", 10*time.Second, "on interrupt, wait this long for in-flight requests")
+	fs.IntVar(&opts.MaxDepth, "depth", 1, "follow links up to this many hops from a seed")
+	fs.IntVar(&opts.MaxPages, "max-pages", 100, "stop after this many URLs (0 for no limit)")
+	fs.StringVar(&opts.Order, "order", crawler.OrderBFS, "which queued URL goes next: "+strings.Join(crawler.Orders, ", "))
+	fs.StringVar(&opts.UserAgent, "user-agent", "gocrawler/1.0", "User-Agent header and robots.txt agent")
+	fs.Var((*headerList)(&opts.Header), "header", "add `Name: value` to every request (repeatable)")
+	fs.Var((*authList)(&opts.Auth), "auth", "send basic auth credentials `host=user:password` to host (repeatable)")
+	fs.Var(proxyURL{&opts.Proxy}, "proxy", "send requests through this http, https or socks5 proxy `url`")
+	fs.BoolVar(&opts.Cookies, "cookies", false, "keep cookies from responses and send them back")
+	fs.IntVar(&opts.MaxRedirects, "max-redirects", 10, "redirects to follow within one request (0 for none)")
+	crossHost := fs.Bool("cross-host-redirects", true, "follow redirects to other hosts within one request")
+	fs.Var((*regexpList)(&opts.Include), "include", "only follow links matching `regexp` (repeatable)")
+	fs.Var((*regexpList)(&opts.Exclude), "exclude", "never follow links matching `regexp` (repeatable)")
+	fs.Var((*stringList)(&opts.AllowHosts), "allow-host", "also follow links to `host` (repeatable)")
+	fs.Var((*stringList)(&opts.Sitemaps), "sitemap", "seed the crawl from sitemap `url` (repeatable, may be gzipped)")
+	fs.BoolVar(&opts.SitemapDiscovery, "robots-sitemaps", false, "also seed from the Sitemap: lines in each seed host's robots.txt")
+	fs.BoolVar(&opts.AnyHost, "any-host", false, "follow links to any host")
+	fs.BoolVar(&opts.StripTracking, "strip-tracking", false, "drop utm_* and similar query parameters")
+	fs.StringVar(&opts.Duplicates, "dupes", "", "detect duplicate pages and flag or skip them: "+strings.Join(crawler.DupModes, ", "))
+	fs.BoolVar(&opts.IgnoreRobots, "ignore-robots", false, "fetch URLs even when robots.txt disallows them")
+	fs.Float64Var(&opts.RequestsPerSecond, "rps", 10, "global requests per second (0 for no limit)")
+	fs.Float64Var(&opts.HostRequestsPerSecond, "host-rps", 2, "requests per second per host (0 for no limit)")
+	fs.IntVar(&opts.MaxConnsPerHost, "host-conns", 2, "concurrent requests per host (0 for no limit)")
+	fs.IntVar(&opts.MaxAttempts, "attempts", 3, "tries per URL, including the first")
+	extract := fs.String("extract", "", "extract page content with these comma-separated processors: all or "+strings.Join(crawler.ProcessorNames, ", "))
+	fs.IntVar(&opts.ExtractWorkers, "extract-workers", 2, "goroutines running the -extract processors")
+	fs.StringVar(&opts.Format, "format", "text", "output format: "+strings.Join(crawler.OutputFormats, ", ")+"; for graph, "+strings.Join(crawler.GraphFormats, ", "))
+	fs.StringVar(&opts.Output, "o", "", "write results to `file` instead of stdout")
+	fs.StringVar(&opts.CheckpointFile, "checkpoint", "", "save the crawl frontier to `file` so it can be resumed")
+	fs.DurationVar(&opts.CheckpointInterval, "checkpoint-every", 30*time.Second, "how often to save the checkpoint")
+	fs.BoolVar(&opts.ResumeCrawl, "resume", false, "continue the crawl saved in -checkpoint")
+	fs.DurationVar(&opts.Progress, "progress", 0, "print crawl progress to stderr this often (0 to disable)")
+	fs.StringVar(&opts.MetricsAddr, "metrics-addr", "", "serve Prometheus metrics at http://`addr`/metrics")
+	fs.StringVar(&opts.Record, "record", "", "record every request and response to cassette `file`")
+	fs.StringVar(&opts.Replay, "replay", "", "replay responses from cassette `file` instead of the network")
+	fs.StringVar(&opts.CacheDir, "cache", "", "cache responses in `dir` and revalidate them with conditional requests")
+	fs.IntVar(&opts.MaxErrors, "max-errors", -1, "exit with status 1 if more than `n` URLs fail (-1 to never fail)")
+
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	if *configFile != "" {
+		if err := loadConfig(fs, *configFile); err != nil {
+			return opts, err
+		}
+	}
+	opts.SameHostRedirects = !*crossHost
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if opts.LinkCheck || opts.Graph {
+		if !set["depth"] {
+			opts.MaxDepth = math.MaxInt32
+		}
+		if !set["max-pages"] {
+			opts.MaxPages = 0
+		}
+	}
+	if opts.Graph && !set["format"] {
+		opts.Format = "dot"
+	}
+
+	if *extract != "" {
+		p, err := crawler.ProcessorsByName(strings.Split(*extract, ","))
+		if err != nil {
+			return opts, err
+		}
+		opts.Extract = p
+	}
+
+	opts.Seeds = fs.Args()
+	if *seedsFile != "" {
+		seeds, err := readSeeds(*seedsFile, stdin)
+		if err != nil {
+			return opts, err
+		}
+		opts.Seeds = append(opts.Seeds, seeds...)
+	}
+
+	switch {
+	case opts.Record != "" && opts.Replay != "":
+		return opts, errors.New("-record and -replay can't be used together")
+	case opts.ResumeCrawl && opts.CheckpointFile == "":
+		return opts, errors.New("-resume needs -checkpoint")
+	case len(opts.Seeds) == 0 && len(opts.Sitemaps) == 0 && !opts.ResumeCrawl:
+		fs.Usage()
+		return opts, errors.New("no seed URLs given")
+	case opts.Workers < 1:
+		return opts, errors.New("-workers must be at least 1")
+	case opts.MaxWorkers > 0 && (opts.MinWorkers < 1 || opts.MinWorkers > opts.MaxWorkers):
+		return opts, errors.New("-min-workers must be between 1 and -max-workers")
+	case opts.Duplicates != "" && !oneOf(opts.Duplicates, crawler.DupModes):
+		return opts, fmt.Errorf("unknown -dupes %q (want one of %s)", opts.Duplicates, strings.Join(crawler.DupModes, ", "))
+	case !oneOf(opts.Order, crawler.Orders):
+		return opts, fmt.Errorf("unknown -order %q (want one of %s)", opts.Order, strings.Join(crawler.Orders, ", "))
+	case opts.LinkCheck && !oneOf(opts.Format, linkCheckFormats):
+		return opts, fmt.Errorf("linkcheck can't write -format %q (want one of %s)", opts.Format, strings.Join(linkCheckFormats, ", "))
+	case opts.Graph && !oneOf(opts.Format, crawler.GraphFormats):
+		return opts, fmt.Errorf("graph can't write -format %q (want one of %s)", opts.Format, strings.Join(crawler.GraphFormats, ", "))
+	case !opts.Graph && !oneOf(opts.Format, crawler.OutputFormats):
+		return opts, fmt.Errorf("unknown -format %q (want one of %s)", opts.Format, strings.Join(crawler.OutputFormats, ", "))
+	case opts.MaxRedirects < 0:
+		return opts, errors.New("-max-redirects can't be negative")
+	}
+	if opts.MaxRedirects == 0 {
+		opts.MaxRedirects = -1 // crawler.Config takes 0 to mean its default
+	}
+	return opts, nil
+}
+
+func oneOf(s string, choices []string) bool {
+	for _, c := range choices {
+		if c == s {
+			return true
+		}
+	}
+	return false
+}
+
+// readSeeds reads one URL per line, skipping blank lines and # comments.
+func readSeeds(name string, stdin io.Reader) ([]string, error) {
+	r := stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var seeds []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		seeds = append(seeds, line)
+	}
+	return seeds, scanner.Err()
+}
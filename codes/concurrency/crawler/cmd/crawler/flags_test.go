@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFlags(t *testing.T) {
+	stdin := strings.NewReader("# seeds\nhttps://b.example\n\nhttps://c.example\n")
+	opts, err := parseFlags([]string{
+		"-seeds", "-",
+		"-workers", "8",
+		"-timeout", "2s",
+		"-exclude", `\.pdf$`,
+		"-format", "jsonl",
+		"https://a.example",
+	}, stdin, io.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"https://a.example", "https://b.example", "https://c.example"}
+	if strings.Join(opts.Seeds, " ") != strings.Join(want, " ") {
+		t.Errorf("got seeds %v want %v", opts.Seeds, want)
+	}
+	if opts.Workers != 8 || opts.Timeout != 2*time.Second || opts.Format != "jsonl" {
+		t.Errorf("got workers=%d timeout=%v format=%q", opts.Workers, opts.Timeout, opts.Format)
+	}
+	if len(opts.Exclude) != 1 || !opts.Exclude[0].MatchString("/report.pdf") {
+		t.Errorf("got exclude %v", opts.Exclude)
+	}
+}
+
+func TestParseFlagsErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"-workers", "0", "https://a.example"},
+		{"-format", "xml", "https://a.example"},
+		{"-include", "(", "https://a.example"},
+		{"-dupes", "drop", "https://a.example"},
+		{"linkcheck", "-format", "csv", "https://a.example"},
+		{"graph", "-format", "csv", "https://a.example"},
+		{"-format", "dot", "https://a.example"},
+		{"-header", "no-colon", "https://a.example"},
+		{"-auth", "a.example", "https://a.example"},
+		{"-proxy", "ftp://proxy.example", "https://a.example"},
+		{"-max-redirects", "-1", "https://a.example"},
+	} {
+		if _, err := parseFlags(args, strings.NewReader(""), io.Discard); err == nil {
+			t.Errorf("parseFlags(%q) should fail", args)
+		}
+	}
+}
+
+func TestParseFlagsLinkCheck(t *testing.T) {
+	opts, err := parseFlags([]string{"linkcheck", "https://a.example"}, strings.NewReader(""), io.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !opts.LinkCheck || !opts.CheckLinks || opts.MaxPages != 0 || opts.MaxDepth < 1000 {
+		t.Errorf("got linkcheck=%v check=%v max-pages=%d depth=%d", opts.LinkCheck, opts.CheckLinks, opts.MaxPages, opts.MaxDepth)
+	}
+
+	opts, err = parseFlags([]string{"linkcheck", "-depth", "2", "https://a.example"}, strings.NewReader(""), io.Discard)
+	if err != nil || opts.MaxDepth != 2 {
+		t.Errorf("got depth %d, err %v; -depth should still apply", opts.MaxDepth, err)
+	}
+}
+
+func TestParseFlagsGraph(t *testing.T) {
+	opts, err := parseFlags([]string{"graph", "https://a.example"}, strings.NewReader(""), io.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !opts.Graph || opts.Format != "dot" || opts.MaxPages != 0 || opts.MaxDepth < 1000 {
+		t.Errorf("got graph=%v format=%q max-pages=%d depth=%d", opts.Graph, opts.Format, opts.MaxPages, opts.MaxDepth)
+	}
+
+	opts, err = parseFlags([]string{"graph", "-format", "graphml", "https://a.example"}, strings.NewReader(""), io.Discard)
+	if err != nil || opts.Format != "graphml" {
+		t.Errorf("got format %q, err %v", opts.Format, err)
+	}
+}
+
+func TestParseFlagsRequests(t *testing.T) {
+	opts, err := parseFlags([]string{
+		"-header", "Accept-Language: en",
+		"-header", "X-Team:search",
+		"-auth", "Intranet.example=crawler:pa:ss",
+		"-proxy", "socks5://127.0.0.1:1080",
+		"-cookies",
+		"-max-redirects", "0",
+		"-cross-host-redirects=false",
+		"https://a.example",
+	}, strings.NewReader(""), io.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if opts.Header.Get("Accept-Language") != "en" || opts.Header.Get("X-Team") != "search" {
+		t.Errorf("got header %v", opts.Header)
+	}
+	if a := opts.Auth["intranet.example"]; a.Username != "crawler" || a.Password != "pa:ss" {
+		t.Errorf("got auth %v", opts.Auth)
+	}
+	if opts.Proxy == nil || opts.Proxy.String() != "socks5://127.0.0.1:1080" {
+		t.Errorf("got proxy %v", opts.Proxy)
+	}
+	if !opts.Cookies || opts.MaxRedirects != -1 || !opts.SameHostRedirects {
+		t.Errorf("got cookies=%v max-redirects=%d same-host=%v", opts.Cookies, opts.MaxRedirects, opts.SameHostRedirects)
+	}
+}
@@ -0,0 +1,212 @@
+// Command crawler crawls websites from the command line. It is a thin
+// wrapper around the crawler package: flags become a crawler.Config and
+// results are written out as they arrive.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/foyez/golang/codes/concurrency/crawler"
+)
+
+func main() {
+	os.Exit(crawlMain())
+}
+
+// crawlMain runs the command and returns its exit status. Keeping it
+// apart from main lets deferred cleanup (sinks, cassettes, the metrics
+// server) run before the process exits.
+func crawlMain() int {
+	opts, err := parseFlags(os.Args[1:], os.Stdin, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "crawler:", err)
+		return 2
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out := os.Stdout
+	if opts.Output != "" {
+		f, err := os.Create(opts.Output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "crawler:", err)
+			return 2
+		}
+		defer f.Close()
+		out = f
+	}
+	// In linkcheck and graph mode results feed the checker or the
+	// graph instead of a sink.
+	var sink crawler.Sink
+	var links *crawler.LinkChecker
+	var graph *crawler.Graph
+	switch {
+	case opts.LinkCheck:
+		links = crawler.NewLinkChecker(opts.Config)
+	case opts.Graph:
+		graph = crawler.NewGraph(opts.Config)
+	default:
+		sink, err = crawler.NewSink(opts.Format, out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "crawler:", err)
+			return 2
+		}
+	}
+
+	if opts.ResumeCrawl {
+		resume, err := crawler.LoadCheckpoint(opts.CheckpointFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "crawler:", err)
+			return 2
+		}
+		if len(opts.Seeds) == 0 {
+			opts.Seeds = resume.Seeds
+		}
+		opts.Resume = resume
+		fmt.Fprintf(os.Stderr, "Resuming crawl: %d pending, %d visited\n", len(resume.Pending), len(resume.Visited))
+	}
+
+	// The cassette and the cache wrap the network transport, so the
+	// proxy goes on that rather than being left to the crawler.
+	network := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.Proxy != nil {
+		network.Proxy = http.ProxyURL(opts.Proxy)
+	}
+	client := &http.Client{Timeout: opts.Timeout, Transport: network}
+	switch {
+	case opts.Record != "":
+		// Record as much as the crawler will read, sitemaps included.
+		maxBody := opts.MaxBodySize
+		if maxBody > 0 && (len(opts.Sitemaps) > 0 || opts.SitemapDiscovery) {
+			maxBody = max(maxBody, crawler.MaxSitemapSize)
+		}
+		rec, err := crawler.NewRecordingTransport(network, opts.Record, maxBody)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "crawler:", err)
+			return 2
+		}
+		defer func() {
+			if err := rec.Close(); err != nil {
+				fmt.Fprintln(os.Stderr, "crawler: writing cassette:", err)
+			}
+		}()
+		client.Transport = rec
+	case opts.Replay != "":
+		rep, err := crawler.NewReplayTransport(opts.Replay)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "crawler:", err)
+			return 2
+		}
+		client.Transport = rep
+	}
+	if opts.CacheDir != "" {
+		cache, err := crawler.NewCachingTransport(client.Transport, opts.CacheDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "crawler:", err)
+			return 2
+		}
+		client.Transport = cache
+	}
+	opts.Client = client
+	c := crawler.New(opts.Config)
+	stopSignals := handleSignals(c.Shutdown, cancel, opts.Grace)
+	defer stopSignals()
+
+	if opts.Progress > 0 {
+		ticker := time.NewTicker(opts.Progress)
+		defer ticker.Stop()
+		go func() {
+			for range ticker.C {
+				fmt.Fprintln(os.Stderr, c.Stats().ProgressLine())
+			}
+		}()
+	}
+
+	if opts.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", c.Metrics())
+		srv := &http.Server{Addr: opts.MetricsAddr, Handler: mux}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fmt.Fprintln(os.Stderr, "crawler: metrics:", err)
+			}
+		}()
+		defer srv.Close()
+	}
+
+	var sinkErr error
+
+	// Consume results
+	sum := c.Run(ctx, func(r crawler.Result) {
+		if links != nil {
+			links.Add(r)
+			return
+		}
+		if graph != nil {
+			graph.Add(r)
+			return
+		}
+		if err := sink.Write(crawler.NewRecord(r)); err != nil && sinkErr == nil {
+			sinkErr = err
+		}
+	})
+
+	var broken []crawler.BrokenLink
+	switch {
+	case links != nil:
+		broken = links.Broken()
+		sinkErr = crawler.WriteBrokenLinks(out, opts.Format, broken)
+	case graph != nil:
+		sinkErr = crawler.WriteGraph(out, opts.Format, graph)
+	default:
+		if err := sink.Close(); err != nil && sinkErr == nil {
+			sinkErr = err
+		}
+	}
+	if sinkErr != nil {
+		fmt.Fprintln(os.Stderr, "crawler: writing results:", sinkErr)
+	}
+
+	switch {
+	case sum.Limit != "":
+		fmt.Fprintf(os.Stderr, "Crawl stopped by the %s limit: %d fetched, %d failed, %d skipped, %d not fetched\n", sum.Limit, sum.Fetched, sum.Failed, sum.Skipped, sum.Unfetched)
+	case c.Interrupted() || ctx.Err() != nil:
+		fmt.Fprintf(os.Stderr, "Crawl interrupted: %d fetched, %d failed, %d skipped, %d not fetched\n", sum.Fetched, sum.Failed, sum.Skipped, sum.Unfetched)
+	default:
+		fmt.Fprintf(os.Stderr, "Crawling finished: %d fetched, %d failed, %d skipped\n", sum.Fetched, sum.Failed, sum.Skipped)
+	}
+	c.Stats().Print(os.Stderr)
+	crawler.PrintDuplicates(os.Stderr, sum.Duplicates)
+	if sum.SaveErr != nil {
+		fmt.Fprintln(os.Stderr, "crawler: saving checkpoint:", sum.SaveErr)
+	} else if sum.Checkpoint && sum.Unfetched > 0 {
+		fmt.Fprintf(os.Stderr, "Checkpoint saved to %s; continue with -resume\n", opts.CheckpointFile)
+	}
+
+	if links != nil {
+		fmt.Fprintf(os.Stderr, "%d broken links\n", len(broken))
+	}
+	if graph != nil {
+		fmt.Fprintln(os.Stderr, "Link graph")
+		graph.Summary(10).Print(os.Stderr)
+	}
+
+	if opts.MaxErrors >= 0 && sum.Failed > opts.MaxErrors {
+		fmt.Fprintf(os.Stderr, "crawler: %d errors (max %d)\n", sum.Failed, opts.MaxErrors)
+		return 1
+	}
+	if len(broken) > 0 {
+		return 1
+	}
+	return 0
+}
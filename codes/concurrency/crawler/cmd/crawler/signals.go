@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// handleSignals turns SIGINT and SIGTERM into a graceful shutdown: the
+// first signal calls stop so no new URLs are started, and cancel runs
+// once grace has passed to abort whatever is still in flight. A second
+// signal exits immediately. The returned func stops listening.
+func handleSignals(stop func(), cancel context.CancelFunc, grace time.Duration) func() {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	quit := make(chan struct{})
+
+	go func() {
+		select {
+		case <-sigs:
+		case <-quit:
+			return
+		}
+		fmt.Fprintf(os.Stderr, "\nShutting down: waiting up to %v for in-flight requests (interrupt again to force)\n", grace)
+		stop()
+		timer := time.AfterFunc(grace, cancel)
+		defer timer.Stop()
+
+		select {
+		case <-sigs:
+			fmt.Fprintln(os.Stderr, "Forced exit")
+			os.Exit(130)
+		case <-quit:
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(quit)
+	}
+}
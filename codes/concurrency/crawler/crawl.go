@@ -0,0 +1,544 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config controls where the crawler starts, how far it goes and how it
+// fetches. The zero value of each field is a sensible default.
+type Config struct {
+	Seeds    []string
+	Workers  int // workers to start with; 0 means 1
+	MaxDepth int // links are followed up to this many hops from a seed
+	MaxPages int // stop queueing new URLs after this many; 0 means no limit
+
+	// With MaxWorkers set, the pool grows by one worker at a time while
+	// fetches take less than ScaleLatency (1s if zero) and URLs are
+	// waiting, and halves when errors and 429s climb, staying between
+	// MinWorkers and MaxWorkers.
+	MinWorkers   int
+	MaxWorkers   int
+	ScaleLatency time.Duration
+
+	// Order picks which queued URL of a host goes next: OrderBFS (the
+	// default), OrderDFS or OrderPriority. Score, if set, overrides it;
+	// higher scores go first. Hosts always take turns.
+	Order string
+	Score func(Job) float64
+
+	MaxBodySize int64 // bytes of each response body to keep; 0 means no cap
+
+	// Crawl-wide limits; zero means none. When one is reached, in-flight
+	// fetches are cancelled and kept for the checkpoint.
+	Deadline time.Duration // how long the whole crawl may run
+	MaxBytes int64         // total response body bytes to download
+
+	// Extract, if set, runs on every HTML page in a stage of
+	// ExtractWorkers goroutines between the workers and Run, and its
+	// output is attached to the Result.
+	Extract        Processor
+	ExtractWorkers int
+
+	// By default only links on the seed hosts are followed.
+	AllowHosts []string // extra hosts to follow
+	AnyHost    bool     // follow links to any host
+
+	// Discovered links must match an Include pattern (if any are given)
+	// and no Exclude pattern. Seeds are always fetched.
+	Include []*regexp.Regexp
+	Exclude []*regexp.Regexp
+
+	StripTracking bool // drop utm_* and similar params before deduplicating
+
+	// Duplicates, if set to DupFlag or DupSkip, compares the content of
+	// every page with the pages before it, exactly and by simhash.
+	Duplicates string
+
+	// CheckLinks also fetches the links that aren't crawled, because
+	// they are on another host or one hop past MaxDepth, without
+	// following them. Off-host links are tried with HEAD first.
+	CheckLinks bool
+
+	UserAgent    string
+	IgnoreRobots bool // fetch URLs even when robots.txt disallows them
+
+	// Fetcher fetches every URL, robots.txt and sitemaps included. If
+	// nil, pages are fetched over HTTP with Client (a client with a 30s
+	// timeout if nil), UserAgent, MaxBodySize and Timeouts, and the
+	// settings below.
+	Fetcher  Fetcher
+	Client   *http.Client
+	Timeouts Timeouts
+
+	// Header is added to every request, and the credentials in Auth to
+	// requests for their host ("example.com" or "example.com:8080").
+	Header http.Header
+	Auth   map[string]BasicAuth
+
+	// Proxy is an http, https or socks5 URL to send requests through;
+	// nil uses $HTTP_PROXY and friends. It only takes effect when
+	// Client has no Transport or an *http.Transport.
+	Proxy *url.URL
+
+	Cookies bool // keep cookies from responses and send them back
+
+	// MaxRedirects caps the redirects followed within one fetch: 0
+	// means 10, and a negative value follows none. SameHostRedirects
+	// refuses redirects to another host. Either way, a redirect that
+	// isn't followed is reported as a 3xx page linking to its target.
+	MaxRedirects      int
+	SameHostRedirects bool
+
+	// Politeness limits; zero values mean no limit.
+	RequestsPerSecond     float64 // across all hosts
+	HostRequestsPerSecond float64 // per host, lowered further by Crawl-delay
+	HostBurst             int     // requests a host may get back to back
+	MaxConnsPerHost       int     // concurrent requests per host
+
+	// Network errors, 5xx and 429 are retried with exponential backoff.
+	MaxAttempts    int // tries per URL including the first; 0 means 1
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration // also the longest Retry-After we wait for; 0 means no cap
+
+	// Sitemaps to seed the crawl from. With SitemapDiscovery, the
+	// Sitemap lines in each seed host's robots.txt are used as well,
+	// even with IgnoreRobots.
+	Sitemaps         []string
+	SitemapDiscovery bool
+
+	// With a CheckpointFile, the frontier is saved every
+	// CheckpointInterval (if set) and when the crawl ends.
+	CheckpointFile     string
+	CheckpointInterval time.Duration
+
+	// Resume continues the crawl saved in a checkpoint instead of
+	// starting afresh; see LoadCheckpoint.
+	Resume *Checkpoint
+}
+
+// Job is a single URL waiting to be fetched.
+type Job struct {
+	URL    string `json:"url"`
+	Depth  int    `json:"depth"`
+	Parent string `json:"parent,omitempty"`
+
+	// Set for URLs that came from a sitemap.
+	Sitemap  bool      `json:"sitemap,omitempty"`
+	Priority float64   `json:"priority,omitempty"`
+	LastMod  time.Time `json:"lastmod,omitzero"`
+
+	// Set for links that are checked but not crawled; see CheckLinks.
+	CheckOnly bool `json:"check_only,omitempty"`
+	Head      bool `json:"head,omitempty"` // try HEAD before GET
+}
+
+// Crawler crawls the web from a Config. It holds the state shared by
+// the coordinator and its workers, and can be run once.
+type Crawler struct {
+	cfg            Config
+	fetcher        Fetcher
+	sitemapFetcher Fetcher      // fetcher with a size cap fit for sitemaps
+	robots         *robotsCache // nil when robots.txt is ignored
+	sched          *scheduler
+	retry          retryPolicy
+	stats          *stats
+	metrics        *metrics
+
+	stopping chan struct{} // closed by Shutdown
+	stopOnce sync.Once
+}
+
+// Summary is what Run reports when it returns.
+type Summary struct {
+	Counters
+	Unfetched  int   // URLs left in the queue by a shutdown
+	SaveErr    error // last failure writing the checkpoint, if any
+	Checkpoint bool  // the final state was written to CheckpointFile
+
+	Duplicates [][]string // each original URL followed by its duplicates
+
+	Limit string // LimitDeadline or LimitBudget if one ended the crawl
+}
+
+// New returns a Crawler for cfg.
+func New(cfg Config) *Crawler {
+	cfg.Workers = max(cfg.Workers, 1)
+
+	fetcher, sitemapFetcher := cfg.Fetcher, cfg.Fetcher
+	if fetcher == nil {
+		f := newHTTPFetcher(newClient(cfg), cfg.UserAgent, cfg.MaxBodySize)
+		f.timeouts = cfg.Timeouts
+		f.header = cfg.Header
+		f.auth = cfg.Auth
+		sf := *f
+		sf.maxBody = MaxSitemapSize
+		fetcher, sitemapFetcher = f, &sf
+	}
+
+	c := &Crawler{
+		cfg:            cfg,
+		fetcher:        fetcher,
+		sitemapFetcher: sitemapFetcher,
+		sched:          newScheduler(cfg),
+		retry:          newRetryPolicy(cfg),
+		stats:          newStats(10 * time.Second),
+		metrics:        newMetrics(),
+
+		stopping: make(chan struct{}),
+	}
+	if !cfg.IgnoreRobots {
+		c.robots = newRobotsCache(retryingFetcher{c}, cfg.UserAgent)
+	}
+	return c
+}
+
+// Shutdown asks Run to stop handing out new URLs. Fetches already in
+// flight carry on until they finish or Run's ctx is cancelled. It is
+// safe to call from any goroutine, more than once.
+func (c *Crawler) Shutdown() {
+	c.stopOnce.Do(func() { close(c.stopping) })
+}
+
+// Interrupted reports whether Shutdown has been called.
+func (c *Crawler) Interrupted() bool {
+	select {
+	case <-c.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run starts the worker pool, feeds it the seeds and then every link
+// the workers discover, until nothing is left to fetch. Each result is
+// passed to handle on the calling goroutine.
+//
+// Run itself is the only goroutine that touches the frontier, so workers
+// never send to jobs and the pool cannot deadlock on a full channel.
+func (c *Crawler) Run(ctx context.Context, handle func(Result)) Summary {
+	cfg := c.cfg
+	ctx, stopCrawl := context.WithCancelCause(ctx)
+	defer stopCrawl(nil)
+	if cfg.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, cfg.Deadline, errCrawlDeadline)
+		defer cancel()
+	}
+
+	jobs := make(chan Job)
+	fetched := make(chan Result)
+	var results <-chan Result = fetched
+
+	var wg sync.WaitGroup
+	workers := newPool(func(id int, quit <-chan struct{}) {
+		wg.Add(1)
+		go c.worker(ctx, id, jobs, fetched, quit, &wg)
+	})
+	var scaler *aimd
+	if cfg.MaxWorkers > 0 {
+		scaler = newAIMD(cfg)
+		workers.resize(min(max(cfg.Workers, scaler.min), scaler.max))
+	} else {
+		workers.resize(cfg.Workers)
+	}
+	if cfg.Extract != nil {
+		results = extractStage(fetched, cfg.ExtractWorkers, cfg.Extract)
+	}
+
+	hosts := make(map[string]bool)
+	for _, h := range cfg.AllowHosts {
+		hosts[strings.ToLower(h)] = true
+	}
+	for _, s := range append(cfg.Seeds[:len(cfg.Seeds):len(cfg.Seeds)], cfg.Sitemaps...) {
+		if u, err := url.Parse(s); err == nil {
+			hosts[strings.ToLower(u.Hostname())] = true
+		}
+	}
+	onHost := func(link string) bool {
+		if cfg.AnyHost {
+			return true
+		}
+		u, err := url.Parse(link)
+		return err == nil && hosts[strings.ToLower(u.Hostname())]
+	}
+	wanted := func(link string) bool {
+		for _, re := range cfg.Exclude {
+			if re.MatchString(link) {
+				return false
+			}
+		}
+		for _, re := range cfg.Include {
+			if re.MatchString(link) {
+				return true
+			}
+		}
+		return len(cfg.Include) == 0
+	}
+	follow := func(link string) bool { return onHost(link) && wanted(link) }
+
+	visited := newVisitedSet()
+	var dupes *dupIndex
+	if cfg.Duplicates != "" {
+		dupes = newDupIndex()
+	}
+	queue := newFrontier(cfg.Order, cfg.Score)
+	var leftover []Job
+	inflight := make(map[string]Job)
+	var sum Summary
+	stopped := false
+	// enqueue queues j unless an equivalent URL was seen before. The
+	// normalized form is only the visited-set key: j.URL is fetched as
+	// it was linked, since servers may read ?a=2&a=1 or ?flag
+	// differently from what normalization turns them into.
+	enqueue := func(j Job) error {
+		key, err := normalizeURL(j.URL, cfg.StripTracking)
+		if err != nil {
+			return err
+		}
+		if stopped || (cfg.MaxPages > 0 && visited.Len() >= cfg.MaxPages) {
+			return nil
+		}
+		if visited.Add(key) {
+			queue.push(j)
+		}
+		return nil
+	}
+	if cfg.Resume != nil {
+		for _, u := range cfg.Resume.Visited {
+			visited.Add(u)
+		}
+		for _, j := range cfg.Resume.Pending {
+			queue.push(j)
+		}
+		sum.Counters = cfg.Resume.Counters
+	}
+	// finish records a result that is done for good and hands it on.
+	var downloaded int64
+	finish := func(r Result) {
+		if cfg.MaxBytes > 0 && r.Page != nil {
+			downloaded += int64(len(r.Page.Body))
+			if downloaded >= cfg.MaxBytes {
+				stopCrawl(errByteBudget)
+			}
+		}
+		sum.add(r)
+		c.stats.record(r)
+		c.metrics.observe(r)
+		handle(r)
+	}
+	for _, s := range cfg.Seeds {
+		if err := enqueue(Job{URL: s}); err != nil {
+			finish(Result{URL: s, Err: err})
+		}
+	}
+
+	// Sitemaps are read in the background; their URLs join the queue
+	// as each file arrives.
+	var sitemaps chan sitemapBatch
+	sitemapCtx, stopSitemaps := context.WithCancel(ctx)
+	defer stopSitemaps()
+	if len(cfg.Sitemaps) > 0 || cfg.SitemapDiscovery {
+		sitemaps = make(chan sitemapBatch)
+		go c.discoverSitemaps(sitemapCtx, sitemaps)
+	}
+
+	save := func() {
+		if cfg.CheckpointFile == "" {
+			return
+		}
+		all := append(leftover[:len(leftover):len(leftover)], queue.jobs()...)
+		cp := newCheckpoint(cfg.Seeds, all, inflight, visited, sum.Counters)
+		sum.SaveErr = saveCheckpoint(cfg.CheckpointFile, cp)
+	}
+	var tick <-chan time.Time
+	if cfg.CheckpointFile != "" && cfg.CheckpointInterval > 0 {
+		ticker := time.NewTicker(cfg.CheckpointInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	done := ctx.Done()
+	stopping := c.stopping
+	pending := 0
+	for queue.Len() > 0 || pending > 0 || sitemaps != nil {
+		c.metrics.setQueueDepth(queue.Len())
+		// A nil channel blocks forever, so the send case is only live
+		// when some host in the queue may be fetched right now.
+		var send chan<- Job
+		var next Job
+		var wake <-chan time.Time
+		var timer *time.Timer
+		next, ok, wait := queue.peek(c.sched.ready)
+		if ok {
+			send = jobs
+		} else if wait > 0 {
+			timer = time.NewTimer(wait)
+			wake = timer.C
+		}
+
+		select {
+		case send <- next:
+			queue.pop(hostOf(next.URL))
+			c.sched.acquire(hostOf(next.URL))
+			inflight[next.URL] = next
+			pending++
+
+		case <-tick:
+			save()
+
+		case <-wake:
+			// A host has a token again.
+
+		case r := <-results:
+			pending--
+			job := inflight[r.URL]
+			delete(inflight, r.URL)
+			c.release(r)
+			if scaler != nil {
+				workers.resize(scaler.observe(r, workers.size(), queue.Len()))
+			}
+			if ctx.Err() != nil && errors.Is(r.Err, ctx.Err()) {
+				// Aborted by us, not a real failure: fetch it next time.
+				leftover = append(leftover, job)
+				continue
+			}
+			if r.Page != nil {
+				// Don't fetch the target of a redirect a second time.
+				if u, err := normalizeURL(r.Page.FinalURL, cfg.StripTracking); err == nil {
+					visited.Add(u)
+				}
+			}
+			if dupes != nil && r.Hash != "" {
+				if orig := dupes.check(r.URL, r.Hash, r.Simhash); orig != "" {
+					r.DuplicateOf = orig
+					if cfg.Duplicates == DupSkip {
+						r.Skipped = "duplicate of " + orig
+					}
+				}
+			}
+			finish(r)
+			if r.Page == nil || r.Err != nil || r.Skipped != "" {
+				continue
+			}
+			for _, link := range r.Links {
+				next := Job{URL: link, Depth: r.Depth + 1, Parent: r.URL}
+				switch {
+				case r.Depth < cfg.MaxDepth && follow(link):
+					enqueue(next)
+				case cfg.CheckLinks && wanted(link):
+					next.CheckOnly, next.Head = true, !onHost(link)
+					enqueue(next)
+				}
+			}
+
+		case b, ok := <-sitemaps:
+			if !ok {
+				sitemaps = nil
+				continue
+			}
+			if b.Err != nil {
+				finish(Result{URL: b.Source, Err: fmt.Errorf("sitemap: %w", b.Err)})
+				continue
+			}
+			for _, j := range b.Jobs {
+				if follow(j.URL) {
+					enqueue(j)
+				}
+			}
+
+		case <-stopping:
+			// Stop handing out work but keep collecting results for
+			// jobs already in flight. The rest is kept for the
+			// checkpoint.
+			stopSitemaps()
+			sitemaps = nil
+			stopping = nil
+			stopped = true
+			leftover = append(leftover, queue.drain()...)
+
+		case <-done:
+			// Same, except in-flight fetches now fail fast.
+			sitemaps = nil
+			done = nil
+			stopped = true
+			leftover = append(leftover, queue.drain()...)
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+	close(fetched)
+
+	sum.Unfetched = len(leftover)
+	var le *limitError
+	if errors.As(context.Cause(ctx), &le) {
+		sum.Limit = le.Limit
+	}
+	if dupes != nil {
+		sum.Duplicates = dupes.Clusters()
+	}
+	save()
+	sum.Checkpoint = cfg.CheckpointFile != "" && sum.SaveErr == nil
+	return sum
+}
+
+// Results runs the crawl and yields each result as it finishes.
+// Stopping the iteration early cancels the crawl. Use Run to get the
+// Summary as well.
+func (c *Crawler) Results(ctx context.Context) iter.Seq[Result] {
+	return func(yield func(Result) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		stopped := false
+		c.Run(ctx, func(r Result) {
+			if stopped {
+				return
+			}
+			if !yield(r) {
+				stopped = true
+				c.Shutdown()
+				cancel()
+			}
+		})
+	}
+}
+
+// Stats returns the crawl statistics so far. It may be called while the
+// crawl is running.
+func (c *Crawler) Stats() StatsSnapshot {
+	return c.stats.snapshot()
+}
+
+// Metrics returns a handler serving live crawl metrics in the
+// Prometheus text format.
+func (c *Crawler) Metrics() http.Handler {
+	return c.metrics
+}
+
+// release returns r's connection slot and applies the host's
+// Crawl-delay once its robots.txt is known.
+func (c *Crawler) release(r Result) {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return
+	}
+	host := hostOf(r.URL)
+	c.sched.release(host)
+	if c.robots != nil {
+		c.sched.setCrawlDelay(host, c.robots.CrawlDelay(u))
+	}
+}
@@ -0,0 +1,275 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const site = "https://site.test"
+
+func newTestCrawler(cfg Config, f Fetcher) *Crawler {
+	if cfg.Workers == 0 {
+		cfg.Workers = 3
+	}
+	if len(cfg.Seeds) == 0 {
+		cfg.Seeds = []string{site + "/"}
+	}
+	cfg.Fetcher = f
+	return New(cfg)
+}
+
+func crawledURLs(results []Result) []string {
+	var urls []string
+	for _, r := range results {
+		urls = append(urls, r.URL)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+func TestCrawlFollowsLinks(t *testing.T) {
+	f := newFakeFetcher(map[string][]fakeResponse{
+		site + "/":       fakeHTML(`<a href="/a">A</a> <a href="/b#top">B</a> <a href="https://other.test/">x</a>`),
+		site + "/a":      fakeHTML(`<a href="/">home</a> <a href="/a/deep">deep</a>`),
+		site + "/b":      fakeHTML(`<a href="/a?">A again</a>`),
+		site + "/a/deep": fakeHTML(`<a href="/a/deeper">deeper</a>`),
+	})
+
+	var results []Result
+	sum := newTestCrawler(Config{MaxDepth: 2}, f).Run(context.Background(), func(r Result) {
+		results = append(results, r)
+	})
+
+	want := []string{site + "/", site + "/a", site + "/a/deep", site + "/b"}
+	if got := crawledURLs(results); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v want %v", got, want)
+	}
+	for _, u := range want {
+		if n := f.Calls(u); n != 1 {
+			t.Errorf("%s fetched %d times, want once", u, n)
+		}
+	}
+	if sum.Fetched != 4 || sum.Failed != 0 {
+		t.Errorf("got summary %+v", sum)
+	}
+}
+
+func TestCrawlFetchesLinksAsWritten(t *testing.T) {
+	f := newFakeFetcher(map[string][]fakeResponse{
+		site + "/":          fakeHTML(`<a href="/s?flag">flag</a> <a href="/s?a=2&a=1">order</a> <a href="/s?a=1&a=2">same set</a> <a href="/s?flag=">flag again</a>`),
+		site + "/s?flag":    fakeHTML(`flag`),
+		site + "/s?a=2&a=1": fakeHTML(`order`),
+		site + "/s?a=1&a=2": fakeHTML(`sorted`),
+		site + "/s?flag=":   fakeHTML(`empty`),
+	})
+
+	var results []Result
+	newTestCrawler(Config{MaxDepth: 1, IgnoreRobots: true}, f).Run(context.Background(), func(r Result) {
+		results = append(results, r)
+	})
+
+	// Each pair normalizes to the same key, so only the first of each
+	// is fetched, exactly as it was written.
+	want := []string{site + "/", site + "/s?a=2&a=1", site + "/s?flag"}
+	if got := crawledURLs(results); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v want %v", got, want)
+	}
+	for _, r := range results {
+		if r.Err != nil || r.Page.StatusCode != http.StatusOK {
+			t.Errorf("%s: got %v, want the page fetched as written", r.URL, r.Err)
+		}
+	}
+}
+
+func TestCrawlMaxPages(t *testing.T) {
+	f := newFakeFetcher(map[string][]fakeResponse{
+		site + "/": fakeHTML(`<a href="/1">1</a><a href="/2">2</a><a href="/3">3</a><a href="/4">4</a>`),
+	})
+
+	var results []Result
+	newTestCrawler(Config{MaxDepth: 5, MaxPages: 3}, f).Run(context.Background(), func(r Result) {
+		results = append(results, r)
+	})
+	if len(results) != 3 {
+		t.Errorf("got %d results want 3", len(results))
+	}
+}
+
+func TestCrawlResultsStopsEarly(t *testing.T) {
+	f := newFakeFetcher(map[string][]fakeResponse{
+		site + "/": fakeHTML(`<a href="/1">1</a><a href="/2">2</a><a href="/3">3</a><a href="/4">4</a>`),
+	})
+
+	c := newTestCrawler(Config{Workers: 1, MaxDepth: 1, IgnoreRobots: true}, f)
+	var urls []string
+	for r := range c.Results(context.Background()) {
+		urls = append(urls, r.URL)
+		if len(urls) == 2 {
+			break
+		}
+	}
+	if len(urls) != 2 || urls[0] != site+"/" {
+		t.Errorf("got %v", urls)
+	}
+	if !c.Interrupted() {
+		t.Error("breaking out of Results should shut the crawl down")
+	}
+}
+
+func TestCrawlZeroConfig(t *testing.T) {
+	f := newFakeFetcher(map[string][]fakeResponse{
+		site + "/": fakeHTML(`<a href="/1">1</a>`),
+	})
+
+	// No Workers given: New starts one rather than leaving Run idle.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var urls []string
+	New(Config{Seeds: []string{site + "/"}, MaxDepth: 1, IgnoreRobots: true, Fetcher: f}).Run(ctx, func(r Result) {
+		urls = append(urls, r.URL)
+	})
+	if ctx.Err() != nil || len(urls) != 2 {
+		t.Errorf("got %v, ctx %v", urls, ctx.Err())
+	}
+}
+
+func TestCrawlRobots(t *testing.T) {
+	f := newFakeFetcher(map[string][]fakeResponse{
+		site + "/robots.txt": {{Body: "User-agent: *\nDisallow: /private\n"}},
+		site + "/":           fakeHTML(`<a href="/private/x">secret</a> <a href="/public">public</a>`),
+	})
+
+	var skipped []string
+	newTestCrawler(Config{MaxDepth: 1, UserAgent: "gocrawler/1.0"}, f).Run(context.Background(), func(r Result) {
+		if r.Skipped != "" {
+			skipped = append(skipped, r.URL)
+		}
+	})
+
+	if len(skipped) != 1 || skipped[0] != site+"/private/x" {
+		t.Errorf("got skipped %v", skipped)
+	}
+	if n := f.Calls(site + "/private/x"); n != 0 {
+		t.Errorf("disallowed URL fetched %d times", n)
+	}
+}
+
+func TestCrawlRetriesTransientErrors(t *testing.T) {
+	f := newFakeFetcher(map[string][]fakeResponse{
+		site + "/": {
+			{Err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}},
+			{Status: http.StatusServiceUnavailable},
+			{Body: "ok"},
+		},
+	})
+
+	var got Result
+	newTestCrawler(Config{MaxAttempts: 3, RetryBaseDelay: time.Millisecond}, f).Run(context.Background(), func(r Result) {
+		got = r
+	})
+
+	if got.Err != nil || got.Attempts != 3 || len(got.AttemptErrors) != 2 {
+		t.Errorf("got err=%v attempts=%d errors=%v", got.Err, got.Attempts, got.AttemptErrors)
+	}
+}
+
+func TestCrawlShutdownFinishesInFlight(t *testing.T) {
+	slow := fakeResponse{Header: http.Header{"Content-Type": {"text/html"}}, Delay: 50 * time.Millisecond}
+	home := slow
+	home.Body = `<a href="/1">1</a><a href="/2">2</a><a href="/3">3</a><a href="/4">4</a><a href="/5">5</a>`
+	f := newFakeFetcher(map[string][]fakeResponse{site + "/": {home}})
+	for _, p := range []string{"/1", "/2", "/3", "/4", "/5"} {
+		f.responses[site+p] = []fakeResponse{slow}
+	}
+
+	c := newTestCrawler(Config{Workers: 2, MaxDepth: 1, IgnoreRobots: true}, f)
+	var results []Result
+	sum := c.Run(context.Background(), func(r Result) {
+		results = append(results, r)
+		if r.URL == site+"/" {
+			c.Shutdown()
+		}
+	})
+
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("%s: in-flight fetch should finish, got %v", r.URL, r.Err)
+		}
+	}
+	// The coordinator may hand out a job or two before it sees the
+	// shutdown; everything else must be left for a checkpoint.
+	if len(results)+sum.Unfetched != 6 || sum.Unfetched < 3 {
+		t.Errorf("got %d results and %d unfetched", len(results), sum.Unfetched)
+	}
+}
+
+func TestCrawlCancelRequeuesInFlight(t *testing.T) {
+	home := fakeHTML(`<a href="/slow">slow</a>`)
+	f := newFakeFetcher(map[string][]fakeResponse{
+		site + "/":     home,
+		site + "/slow": {{Delay: time.Hour}},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	path := filepath.Join(t.TempDir(), "crawl.json")
+	c := newTestCrawler(Config{MaxDepth: 1, IgnoreRobots: true, CheckpointFile: path}, f)
+
+	done := make(chan Summary)
+	go func() {
+		done <- c.Run(ctx, func(r Result) {
+			if r.URL == site+"/" {
+				time.AfterFunc(20*time.Millisecond, cancel)
+			}
+		})
+	}()
+
+	select {
+	case sum := <-done:
+		if sum.Fetched != 1 || sum.Failed != 0 || sum.Unfetched != 1 {
+			t.Errorf("got summary %+v", sum)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after cancel")
+	}
+
+	cp, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cp.Pending) != 1 || cp.Pending[0].URL != site+"/slow" {
+		t.Errorf("got pending %+v", cp.Pending)
+	}
+}
+
+func TestReplayFetcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording.jsonl")
+	recording := `{"url":"https://site.test/","status":200,"header":{"Content-Type":["text/html"]},"body":"PGEgaHJlZj0iL2EiPmE8L2E+"}` + "\n"
+	if err := os.WriteFile(path, []byte(recording), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewReplayFetcher(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := f.Fetch(context.Background(), site+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !page.IsHTML() || string(page.Body) != `<a href="/a">a</a>` {
+		t.Errorf("got %q (%s)", page.Body, page.ContentType)
+	}
+	if _, err := f.Fetch(context.Background(), site+"/a"); !errors.Is(err, errNotRecorded) {
+		t.Errorf("got %v want errNotRecorded", err)
+	}
+}
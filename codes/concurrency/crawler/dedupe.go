@@ -0,0 +1,177 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// What to do with a page whose content was already seen at another URL.
+const (
+	DupFlag = "flag" // report it with DuplicateOf set
+	DupSkip = "skip" // also report it as skipped and don't follow its links
+)
+
+// DupModes are the valid values of Config.Duplicates.
+var DupModes = []string{DupFlag, DupSkip}
+
+const (
+	shingleSize = 3 // words per shingle for simhash
+	// Pages whose simhashes differ in at most this many bits count as
+	// near duplicates. Must be less than simhashBands.
+	simhashDistance = 3
+	simhashBands    = 4
+)
+
+// contentHash is the hex SHA-256 of body.
+func contentHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// textWords returns the lower-cased words of an HTML page's text.
+func textWords(body []byte) []string {
+	var words []string
+	inTitle := false
+	tokenizeHTML(body, func(tok Token) {
+		switch {
+		case tok.Tag == "title":
+			inTitle = tok.Kind == StartTagToken
+		case tok.Kind == TextToken && !inTitle:
+			words = append(words, strings.FieldsFunc(strings.ToLower(tok.Text), func(r rune) bool {
+				return !isWordRune(r)
+			})...)
+		}
+	})
+	return words
+}
+
+// simhash fingerprints words so that similar texts get fingerprints
+// that differ in few bits. It hashes every run of shingleSize words and
+// returns 0 for texts too short to have one.
+func simhash(words []string) uint64 {
+	if len(words) < shingleSize {
+		return 0
+	}
+	var weights [64]int
+	h := fnv.New64a()
+	for i := 0; i+shingleSize <= len(words); i++ {
+		h.Reset()
+		io.WriteString(h, strings.Join(words[i:i+shingleSize], " "))
+		sum := h.Sum64()
+		for b := range weights {
+			if sum&(1<<b) != 0 {
+				weights[b]++
+			} else {
+				weights[b]--
+			}
+		}
+	}
+	var fp uint64
+	for b, w := range weights {
+		if w > 0 {
+			fp |= 1 << b
+		}
+	}
+	return fp
+}
+
+// fingerprintable reports whether page has content worth comparing.
+// Redirects, error pages and empty bodies often share one body across
+// many URLs, and marking them duplicates would hide what they lead to.
+func fingerprintable(page *Page) bool {
+	return page.StatusCode >= 200 && page.StatusCode < 300 && len(page.Body) > 0
+}
+
+// fingerprint sets r's content hash and, for HTML, its simhash.
+func fingerprint(r *Result) {
+	r.Hash = contentHash(r.Page.Body)
+	if r.Page.IsHTML() {
+		r.Simhash = simhash(textWords(r.Page.Body))
+	}
+}
+
+// dupIndex remembers the content of every original page seen so far.
+// Near duplicates are found by splitting simhashes into bands: two
+// fingerprints within simhashDistance bits must agree on at least one
+// whole band, so only pages sharing a band are compared.
+type dupIndex struct {
+	exact    map[string]string // content hash -> first URL
+	bands    [simhashBands]map[uint64][]simEntry
+	clusters map[string][]string // original URL -> its duplicates
+}
+
+type simEntry struct {
+	fp  uint64
+	url string
+}
+
+func newDupIndex() *dupIndex {
+	d := &dupIndex{exact: make(map[string]string), clusters: make(map[string][]string)}
+	for i := range d.bands {
+		d.bands[i] = make(map[uint64][]simEntry)
+	}
+	return d
+}
+
+func band(fp uint64, i int) uint64 {
+	const width = 64 / simhashBands
+	return fp >> (i * width) & (1<<width - 1)
+}
+
+// check returns the original page that url duplicates, or "" after
+// recording url as an original itself.
+func (d *dupIndex) check(url, hash string, fp uint64) string {
+	if orig, ok := d.exact[hash]; ok {
+		d.clusters[orig] = append(d.clusters[orig], url)
+		return orig
+	}
+	if fp != 0 {
+		for i := range d.bands {
+			for _, e := range d.bands[i][band(fp, i)] {
+				if bits.OnesCount64(e.fp^fp) <= simhashDistance {
+					d.clusters[e.url] = append(d.clusters[e.url], url)
+					return e.url
+				}
+			}
+		}
+	}
+
+	d.exact[hash] = url
+	if fp != 0 {
+		for i := range d.bands {
+			d.bands[i][band(fp, i)] = append(d.bands[i][band(fp, i)], simEntry{fp, url})
+		}
+	}
+	return ""
+}
+
+// Clusters returns each original that has duplicates followed by its
+// duplicates in the order they were found, sorted by original URL.
+func (d *dupIndex) Clusters() [][]string {
+	var clusters [][]string
+	for orig, dups := range d.clusters {
+		clusters = append(clusters, append([]string{orig}, dups...))
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i][0] < clusters[j][0] })
+	return clusters
+}
+
+// PrintDuplicates writes the duplicate clusters found by a crawl.
+func PrintDuplicates(w io.Writer, clusters [][]string) {
+	if len(clusters) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Duplicate content (%d clusters)\n", len(clusters))
+	for _, c := range clusters {
+		fmt.Fprintf(w, "  %s\n", c[0])
+		for _, u := range c[1:] {
+			fmt.Fprintf(w, "    = %s\n", u)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package crawler
+
+import (
+	"context"
+	"math/bits"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const article = `<p>The quick brown fox jumps over the lazy dog while the farmer
+watches from the porch and the cat sleeps in the warm afternoon sun near the
+barn door where the old tractor has been parked since last summer.</p>`
+
+func TestSimhash(t *testing.T) {
+	a := simhash(textWords([]byte(`<title>One</title>` + article + `<footer>Page 1</footer>`)))
+	b := simhash(textWords([]byte(`<title>Two</title>` + article + `<footer>Page 2</footer>`)))
+	other := simhash(textWords([]byte(`<p>Completely different words about databases, indexes,
+		query planners and the cost of sequential scans on very large tables.</p>`)))
+
+	if d := bits.OnesCount64(a ^ b); d > simhashDistance {
+		t.Errorf("near-identical pages differ in %d bits", d)
+	}
+	if d := bits.OnesCount64(a ^ other); d <= simhashDistance {
+		t.Errorf("unrelated pages differ in only %d bits", d)
+	}
+	if simhash([]string{"too", "short"}) != 0 {
+		t.Errorf("texts shorter than a shingle should have no simhash")
+	}
+}
+
+func TestDupIndex(t *testing.T) {
+	d := newDupIndex()
+	for _, tt := range []struct {
+		url, hash string
+		fp        uint64
+		want      string
+	}{
+		{"/a", "h1", 0xF0F0_0000_0000_0000, ""},
+		{"/b", "h1", 0, "/a"},                     // same bytes
+		{"/c", "h2", 0xF0F0_0000_0000_0007, "/a"}, // 3 bits apart
+		{"/d", "h3", 0xF0F0_0000_0000_000F, ""},   // 4 bits apart
+		{"/e", "h4", 0, ""},                       // no simhash, new hash
+		{"/f", "h3", 0xFFFF_FFFF_FFFF_FFFF, "/d"}, // exact wins
+	} {
+		if got := d.check(tt.url, tt.hash, tt.fp); got != tt.want {
+			t.Errorf("check(%s) = %q want %q", tt.url, got, tt.want)
+		}
+	}
+
+	want := [][]string{{"/a", "/b", "/c"}, {"/d", "/f"}}
+	if got := d.Clusters(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got clusters %v want %v", got, want)
+	}
+}
+
+func TestCrawlSkipsDuplicates(t *testing.T) {
+	f := newFakeFetcher(map[string][]fakeResponse{
+		site + "/":       fakeHTML(`<a href="/a">A</a> <a href="/copy">copy</a>`),
+		site + "/a":      fakeHTML(article),
+		site + "/copy":   fakeHTML(strings.Replace(article, "summer", "summer!", 1) + `<a href="/hidden">h</a>`),
+		site + "/hidden": fakeHTML(`hidden`),
+	})
+
+	var results []Result
+	cfg := Config{MaxDepth: 2, Duplicates: DupSkip, Workers: 1}
+	sum := newTestCrawler(cfg, f).Run(context.Background(), func(r Result) {
+		results = append(results, r)
+	})
+
+	var dup Result
+	for _, r := range results {
+		if r.DuplicateOf != "" {
+			dup = r
+		}
+	}
+	if dup.URL != site+"/copy" || dup.DuplicateOf != site+"/a" || !strings.HasPrefix(dup.Skipped, "duplicate of") {
+		t.Errorf("got duplicate %q of %q (skipped %q)", dup.URL, dup.DuplicateOf, dup.Skipped)
+	}
+	if f.Calls(site+"/hidden") != 0 {
+		t.Errorf("links on a skipped duplicate were followed")
+	}
+	if want := [][]string{{site + "/a", site + "/copy"}}; !reflect.DeepEqual(sum.Duplicates, want) {
+		t.Errorf("got clusters %v want %v", sum.Duplicates, want)
+	}
+}
+
+func TestCrawlDuplicatesOnlyCompareContent(t *testing.T) {
+	moved := func(to string) []fakeResponse {
+		return []fakeResponse{{Status: http.StatusMovedPermanently, Header: http.Header{"Location": {to}}}}
+	}
+	missing := []fakeResponse{{Status: http.StatusNotFound, Body: "not found"}}
+	f := newFakeFetcher(map[string][]fakeResponse{
+		site + "/":   fakeHTML(`<a href="/r1">1</a> <a href="/r2">2</a> <a href="/gone1">3</a> <a href="/gone2">4</a>`),
+		site + "/r1": moved("/t1"),
+		site + "/r2": moved("/t2"),
+		site + "/t1": fakeHTML("first target"),
+		site + "/t2": fakeHTML("second target"),
+		// Same body, but a 404 is not content.
+		site + "/gone1": missing,
+		site + "/gone2": missing,
+	})
+
+	cfg := Config{MaxDepth: 2, Duplicates: DupSkip, IgnoreRobots: true}
+	newTestCrawler(cfg, f).Run(context.Background(), func(r Result) {
+		if r.DuplicateOf != "" {
+			t.Errorf("%s marked a duplicate of %s", r.URL, r.DuplicateOf)
+		}
+	})
+	for _, u := range []string{site + "/t1", site + "/t2"} {
+		if f.Calls(u) != 1 {
+			t.Errorf("redirect target %s fetched %d times, want 1", u, f.Calls(u))
+		}
+	}
+}
@@ -0,0 +1,19 @@
+// Package crawler is a concurrent, polite web crawler.
+//
+// A Crawler starts from Config.Seeds (and optionally sitemaps), hands
+// URLs to a pool of workers and follows the links they find, within the
+// depth, host and pattern limits in its Config. It honours robots.txt,
+// rate-limits each host, retries transient failures and can save its
+// frontier to a checkpoint and resume from it.
+//
+//	c := crawler.New(crawler.Config{
+//		Seeds:    []string{"https://example.com/"},
+//		Workers:  4,
+//		MaxDepth: 2,
+//	})
+//	for r := range c.Results(ctx) {
+//		fmt.Println(r.URL, r.Err)
+//	}
+//
+// The crawler command in cmd/crawler is a thin CLI over this package.
+package crawler
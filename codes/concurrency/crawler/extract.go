@@ -0,0 +1,306 @@
+package crawler
+
+import (
+	"fmt"
+	"iter"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Content is what the extraction stage pulls out of an HTML page. Each
+// named field is filled in by one of the built-in processors; other
+// processors put what they find in Extra.
+type Content struct {
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Canonical   string    `json:"canonical,omitempty"`
+	Headings    []Heading `json:"headings,omitempty"`
+	Outbound    []string  `json:"outbound,omitempty"` // links to other hosts
+	Words       int       `json:"words,omitempty"`
+	Text        string    `json:"text,omitempty"` // start of the visible text
+
+	Extra map[string]any `json:"extra,omitempty"` // see Set
+}
+
+// Set records v under key in c.Extra, for processors other than the
+// built-in ones. Keys are best namespaced, like "myorg.prices".
+func (c *Content) Set(key string, v any) {
+	if c.Extra == nil {
+		c.Extra = make(map[string]any)
+	}
+	c.Extra[key] = v
+}
+
+// Heading is an <h1> to <h6> element.
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+}
+
+// Document is a fetched HTML page as processors see it. The page is
+// tokenized once and shared by every processor; see Tokens.
+type Document struct {
+	URL     *url.URL // final URL of the page
+	Page    *Page
+	Anchors []Anchor
+
+	tokens []Token
+	text   []string // visible text runs, built on first use
+}
+
+func newDocument(r Result) (*Document, error) {
+	u, err := url.Parse(r.Page.FinalURL)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{URL: u, Page: r.Page, Anchors: r.Anchors}
+	tokenizeHTML(r.Page.Body, func(tok Token) {
+		doc.tokens = append(doc.tokens, tok)
+	})
+	return doc, nil
+}
+
+// Tokens yields the page's tokens in document order, with each one's
+// index for TextUntil. The tokens are shared, so processors must not
+// change their Attrs.
+func (d *Document) Tokens() iter.Seq2[int, Token] {
+	return func(yield func(int, Token) bool) {
+		for i, tok := range d.tokens {
+			if !yield(i, tok) {
+				return
+			}
+		}
+	}
+}
+
+// visibleText returns the page's text runs, leaving out the title.
+func (d *Document) visibleText() []string {
+	if d.text != nil {
+		return d.text
+	}
+	d.text = []string{}
+	inTitle := false
+	for _, tok := range d.tokens {
+		switch {
+		case tok.Tag == "title":
+			inTitle = tok.Kind == StartTagToken
+		case tok.Kind == TextToken && !inTitle:
+			d.text = append(d.text, tok.Text)
+		}
+	}
+	return d.text
+}
+
+// TextUntil collects the text after token i up to the next end tag
+// named tag, with whitespace collapsed.
+func (d *Document) TextUntil(i int, tag string) string {
+	var parts []string
+	for _, tok := range d.tokens[i+1:] {
+		if tok.Kind == EndTagToken && tok.Tag == tag {
+			break
+		}
+		if tok.Kind == TextToken {
+			parts = append(parts, tok.Text)
+		}
+	}
+	return collapseSpace(strings.Join(parts, " "))
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Processor extracts something from doc into c. Processors run on the
+// extraction stage's goroutines, never on a worker.
+type Processor func(doc *Document, c *Content)
+
+// Chain returns a Processor that runs ps in order.
+func Chain(ps ...Processor) Processor {
+	return func(doc *Document, c *Content) {
+		for _, p := range ps {
+			p(doc, c)
+		}
+	}
+}
+
+// ExtractTitle sets Title from the first <title>.
+func ExtractTitle(doc *Document, c *Content) {
+	for i, tok := range doc.tokens {
+		if tok.Kind == StartTagToken && tok.Tag == "title" {
+			c.Title = doc.TextUntil(i, "title")
+			return
+		}
+	}
+}
+
+// ExtractDescription sets Description from <meta name="description">.
+func ExtractDescription(doc *Document, c *Content) {
+	for _, tok := range doc.tokens {
+		if tok.Kind == StartTagToken && tok.Tag == "meta" && strings.EqualFold(tok.Attrs["name"], "description") {
+			c.Description = collapseSpace(tok.Attrs["content"])
+			return
+		}
+	}
+}
+
+// ExtractCanonical sets Canonical from <link rel="canonical">, resolved
+// against the page URL.
+func ExtractCanonical(doc *Document, c *Content) {
+	for _, tok := range doc.tokens {
+		if tok.Kind != StartTagToken || tok.Tag != "link" {
+			continue
+		}
+		if !slices.Contains(strings.Fields(strings.ToLower(tok.Attrs["rel"])), "canonical") {
+			continue
+		}
+		if u, err := doc.URL.Parse(strings.TrimSpace(tok.Attrs["href"])); err == nil {
+			c.Canonical = u.String()
+		}
+		return
+	}
+}
+
+// ExtractHeadings sets Headings to every <h1> to <h6> in order.
+func ExtractHeadings(doc *Document, c *Content) {
+	for i, tok := range doc.tokens {
+		if tok.Kind != StartTagToken || len(tok.Tag) != 2 || tok.Tag[0] != 'h' || tok.Tag[1] < '1' || tok.Tag[1] > '6' {
+			continue
+		}
+		c.Headings = append(c.Headings, Heading{Level: int(tok.Tag[1] - '0'), Text: doc.TextUntil(i, tok.Tag)})
+	}
+}
+
+// ExtractOutbound sets Outbound to the distinct links that leave the
+// page's host.
+func ExtractOutbound(doc *Document, c *Content) {
+	seen := make(map[string]bool)
+	for _, a := range doc.Anchors {
+		u, err := url.Parse(a.URL)
+		if err != nil || strings.EqualFold(u.Host, doc.URL.Host) || seen[a.URL] {
+			continue
+		}
+		seen[a.URL] = true
+		c.Outbound = append(c.Outbound, a.URL)
+	}
+}
+
+// ExtractWords sets Words to the number of words in the visible text.
+// Runs of punctuation such as "&" or "—" don't count.
+func ExtractWords(doc *Document, c *Content) {
+	c.Words = 0
+	for _, t := range doc.visibleText() {
+		for _, w := range strings.Fields(t) {
+			if strings.IndexFunc(w, isWordRune) >= 0 {
+				c.Words++
+			}
+		}
+	}
+}
+
+func isWordRune(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+// ExtractText returns a Processor that sets Text to the first n bytes
+// of the visible text, cut at a word boundary where possible.
+func ExtractText(n int) Processor {
+	return func(doc *Document, c *Content) {
+		text := collapseSpace(strings.Join(doc.visibleText(), " "))
+		if len(text) > n {
+			cut := n
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+			if space := strings.LastIndexByte(text[:cut], ' '); space > n/2 {
+				cut = space
+			}
+			text = text[:cut]
+		}
+		c.Text = text
+	}
+}
+
+// processors are the built-in processors by the names -extract takes.
+var processors = map[string]Processor{
+	"title":       ExtractTitle,
+	"description": ExtractDescription,
+	"canonical":   ExtractCanonical,
+	"headings":    ExtractHeadings,
+	"outbound":    ExtractOutbound,
+	"words":       ExtractWords,
+	"text":        ExtractText(500),
+}
+
+// ProcessorNames lists the built-in processors in the order "all"
+// runs them.
+var ProcessorNames = []string{"title", "description", "canonical", "headings", "outbound", "words", "text"}
+
+// ProcessorsByName chains the named built-in processors; "all" means
+// every one of them.
+func ProcessorsByName(names []string) (Processor, error) {
+	var ps []Processor
+	for _, name := range names {
+		if name == "all" {
+			return ProcessorsByName(ProcessorNames)
+		}
+		p, ok := processors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown processor %q (want all or some of %s)", name, strings.Join(ProcessorNames, ", "))
+		}
+		ps = append(ps, p)
+	}
+	return Chain(ps...), nil
+}
+
+// extractStage fans results out to n goroutines that run process on
+// every HTML page and fans them back in to the returned channel, which
+// is closed once in is closed and drained.
+func extractStage(in <-chan Result, n int, process Processor) <-chan Result {
+	outs := make([]<-chan Result, max(n, 1))
+	for i := range outs {
+		outs[i] = extractWorker(in, process)
+	}
+	return mergeResults(outs...)
+}
+
+func extractWorker(in <-chan Result, process Processor) <-chan Result {
+	out := make(chan Result)
+	go func() {
+		defer close(out)
+		for r := range in {
+			if r.Err == nil && r.Page != nil && r.Page.IsHTML() && len(r.Page.Body) > 0 {
+				if doc, err := newDocument(r); err == nil {
+					r.Content = &Content{}
+					process(doc, r.Content)
+				}
+			}
+			out <- r
+		}
+	}()
+	return out
+}
+
+// mergeResults copies every value from cs onto one channel.
+func mergeResults(cs ...<-chan Result) <-chan Result {
+	out := make(chan Result)
+	var wg sync.WaitGroup
+
+	wg.Add(len(cs))
+	for _, c := range cs {
+		go func(ch <-chan Result) {
+			defer wg.Done()
+			for r := range ch {
+				out <- r
+			}
+		}(c)
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
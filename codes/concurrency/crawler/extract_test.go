@@ -0,0 +1,115 @@
+package crawler
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+const extractPage = `<html><head>
+<title> Getting  started </title>
+<meta name="Description" content="How to
+install it.">
+<link rel="alternate canonical" href="/start">
+<style>h1 { color: red }</style>
+</head><body>
+<h1>Start <em>here</em></h1>
+<p>Install the tool &amp; run it.</p>
+<h3>Next</h3>
+<a href="https://other.test/x">Other</a> <a href="/local">Local</a> <a href="https://other.test/x">Again</a>
+<script>var words = "not counted";</script>
+</body></html>`
+
+func TestProcessors(t *testing.T) {
+	base, _ := url.Parse(site + "/docs/start?ref=nav")
+	page := &Page{FinalURL: base.String(), ContentType: "text/html", Body: []byte(extractPage)}
+	doc, err := newDocument(Result{Page: page, Anchors: extractAnchors(base, page.Body)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Content
+	p, err := ProcessorsByName([]string{"all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p(doc, &got)
+
+	want := Content{
+		Title:       "Getting started",
+		Description: "How to install it.",
+		Canonical:   site + "/start",
+		Headings:    []Heading{{1, "Start here"}, {3, "Next"}},
+		Outbound:    []string{"https://other.test/x"},
+		Words:       11,
+		Text:        "Start here Install the tool & run it. Next Other Local Again",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+
+	var short Content
+	ExtractText(12)(doc, &short)
+	if short.Text != "Start here" {
+		t.Errorf("got text %q, want it cut at a word boundary", short.Text)
+	}
+
+	if _, err := ProcessorsByName([]string{"title", "bogus"}); err == nil {
+		t.Errorf("unknown processor should fail")
+	}
+}
+
+func TestCrawlExtractStage(t *testing.T) {
+	f := newFakeFetcher(map[string][]fakeResponse{
+		site + "/":  fakeHTML(`<title>Home</title> <a href="/a">A</a> <a href="/b">B</a>`),
+		site + "/a": fakeHTML(`<title>A</title>`),
+		site + "/b": {{Header: map[string][]string{"Content-Type": {"text/plain"}}, Body: "plain"}},
+	})
+
+	titles := make(map[string]string)
+	cfg := Config{MaxDepth: 1, Extract: ExtractTitle, ExtractWorkers: 3}
+	newTestCrawler(cfg, f).Run(context.Background(), func(r Result) {
+		if r.Content != nil {
+			titles[r.URL] = r.Content.Title
+		} else {
+			titles[r.URL] = "-"
+		}
+	})
+
+	want := map[string]string{site + "/": "Home", site + "/a": "A", site + "/b": "-"}
+	if !reflect.DeepEqual(titles, want) {
+		t.Errorf("got %v want %v", titles, want)
+	}
+}
+
+func TestCustomProcessor(t *testing.T) {
+	f := newFakeFetcher(map[string][]fakeResponse{
+		site + "/": fakeHTML(`<title>Shop</title><img src=a.png alt="A"><p>Price: <b class=price>9.99</b></p><img src=b.png>`),
+	})
+
+	// What a processor outside the package would write: it walks the
+	// tokens and records its own result.
+	images := func(doc *Document, c *Content) {
+		var srcs, prices []string
+		for i, tok := range doc.Tokens() {
+			switch {
+			case tok.Kind == StartTagToken && tok.Tag == "img":
+				srcs = append(srcs, tok.Attrs["src"])
+			case tok.Kind == StartTagToken && tok.Attrs["class"] == "price":
+				prices = append(prices, doc.TextUntil(i, tok.Tag))
+			}
+		}
+		c.Set("images", srcs)
+		c.Set("prices", prices)
+	}
+
+	var got *Content
+	cfg := Config{Extract: Chain(ExtractTitle, images), IgnoreRobots: true}
+	newTestCrawler(cfg, f).Run(context.Background(), func(r Result) { got = r.Content })
+
+	want := &Content{Title: "Shop", Extra: map[string]any{"images": []string{"a.png", "b.png"}, "prices": []string{"9.99"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v want %+v", got, want)
+	}
+}
@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// fakeResponse is a canned answer served by fakeFetcher.
+type fakeResponse struct {
+	Status int // defaults to 200
+	Header http.Header
+	Body   string
+	Err    error         // returned instead of a page
+	Delay  time.Duration // wait before answering; cut short by ctx
+	NoHead bool          // answer HEAD with 405 Method Not Allowed
+}
+
+// fakeFetcher is an in-memory Fetcher for tests. Each URL maps to a list
+// of responses served in order; the last one repeats. Unknown URLs get
+// a 404.
+type fakeFetcher struct {
+	mu        sync.Mutex
+	responses map[string][]fakeResponse
+	calls     map[string]int
+}
+
+func newFakeFetcher(responses map[string][]fakeResponse) *fakeFetcher {
+	return &fakeFetcher{responses: responses, calls: make(map[string]int)}
+}
+
+// fakeHTML is a shorthand for a single 200 text/html response.
+func fakeHTML(body string) []fakeResponse {
+	return []fakeResponse{{Header: http.Header{"Content-Type": {"text/html; charset=utf-8"}}, Body: body}}
+}
+
+func (f *fakeFetcher) Fetch(ctx context.Context, url string) (*Page, error) {
+	return f.serve(ctx, url, false)
+}
+
+// Head answers like Fetch but without a body. HEAD requests count as
+// calls too.
+func (f *fakeFetcher) Head(ctx context.Context, url string) (*Page, error) {
+	return f.serve(ctx, url, true)
+}
+
+func (f *fakeFetcher) serve(ctx context.Context, url string, head bool) (*Page, error) {
+	f.mu.Lock()
+	n := f.calls[url]
+	f.calls[url]++
+	list := f.responses[url]
+	f.mu.Unlock()
+
+	resp := fakeResponse{Status: http.StatusNotFound}
+	if len(list) > 0 {
+		resp = list[min(n, len(list)-1)]
+	}
+	if head {
+		if resp.NoHead {
+			resp = fakeResponse{Status: http.StatusMethodNotAllowed}
+		}
+		resp.Body = ""
+	}
+
+	if err := sleepCtx(ctx, resp.Delay); err != nil {
+		return nil, err
+	}
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	header := resp.Header
+	if header == nil {
+		header = http.Header{}
+	}
+	page := &Page{
+		URL:        url,
+		FinalURL:   url,
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:     header,
+		Body:       []byte(resp.Body),
+		Elapsed:    resp.Delay,
+	}
+	if mt, _, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil {
+		page.ContentType = mt
+	}
+	return page, nil
+}
+
+// Calls returns how many times url was fetched.
+func (f *fakeFetcher) Calls(url string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.calls[url]
+}
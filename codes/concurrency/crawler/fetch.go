@@ -0,0 +1,128 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// Page is a fetched response with its body already read.
+type Page struct {
+	URL         string // URL that was requested
+	FinalURL    string // URL after following redirects
+	StatusCode  int
+	Status      string
+	Header      http.Header
+	ContentType string // media type without parameters, e.g. "text/html"
+	Body        []byte
+	Truncated   bool // Body was cut off at the size cap
+	FromCache   bool // the server answered 304 and Body came from the HTTP cache
+	Elapsed     time.Duration
+}
+
+// IsHTML reports whether the page is worth parsing for links.
+func (p *Page) IsHTML() bool {
+	return p.ContentType == "text/html" || p.ContentType == "application/xhtml+xml"
+}
+
+// Fetcher fetches a single URL. Workers depend on this rather than on
+// *http.Client so the crawl can run against fakes and recordings.
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) (*Page, error)
+}
+
+// headFetcher is implemented by Fetchers that can make HEAD requests,
+// which link checking prefers to a full download.
+type headFetcher interface {
+	Head(ctx context.Context, url string) (*Page, error)
+}
+
+// httpFetcher is the Fetcher that goes to the network.
+type httpFetcher struct {
+	client    *http.Client
+	userAgent string
+	maxBody   int64
+	timeouts  Timeouts
+	header    http.Header          // added to every request
+	auth      map[string]BasicAuth // by host
+}
+
+func newHTTPFetcher(client *http.Client, userAgent string, maxBody int64) *httpFetcher {
+	return &httpFetcher{client: client, userAgent: userAgent, maxBody: maxBody}
+}
+
+func (f *httpFetcher) Fetch(ctx context.Context, url string) (*Page, error) {
+	return f.fetch(ctx, http.MethodGet, url)
+}
+
+func (f *httpFetcher) Head(ctx context.Context, url string) (*Page, error) {
+	return f.fetch(ctx, http.MethodHead, url)
+}
+
+// fetch requests url and reads at most maxBody bytes of the response
+// body. A maxBody of 0 or less means no cap. If one of f.timeouts fires
+// the error wraps a *limitError naming it.
+func (f *httpFetcher) fetch(ctx context.Context, method, url string) (*Page, error) {
+	start := time.Now()
+	maxBody := f.maxBody
+
+	reqCtx, timers, stop := withTimeouts(ctx, f.timeouts)
+	defer stop()
+	req, err := http.NewRequestWithContext(reqCtx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range f.header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	if f.userAgent != "" {
+		req.Header.Set("User-Agent", f.userAgent)
+	}
+	if a, ok := authFor(f.auth, req); ok {
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, limitCause(ctx, reqCtx, err)
+	}
+	defer resp.Body.Close()
+
+	timers.start(LimitBody, f.timeouts.Body)
+	var body io.Reader = resp.Body
+	if maxBody > 0 {
+		// Read one extra byte so we can tell a body that is exactly
+		// maxBody long from one that was cut off.
+		body = io.LimitReader(resp.Body, maxBody+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, limitCause(ctx, reqCtx, err)
+	}
+
+	fromCache := resp.Header.Get(cacheHeader) != ""
+	resp.Header.Del(cacheHeader)
+	page := &Page{
+		URL:        url,
+		FinalURL:   resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+		Body:       data,
+		FromCache:  fromCache,
+		Elapsed:    time.Since(start),
+	}
+	if maxBody > 0 && int64(len(data)) > maxBody {
+		page.Body = data[:maxBody]
+		page.Truncated = true
+	}
+	if mt, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		page.ContentType = mt
+	}
+
+	return page, nil
+}
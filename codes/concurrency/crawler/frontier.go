@@ -0,0 +1,175 @@
+package crawler
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Frontier orderings.
+const (
+	OrderBFS      = "bfs"      // shallowest first, then first found
+	OrderDFS      = "dfs"      // most recently found first
+	OrderPriority = "priority" // sitemap priority, then freshness, then depth
+)
+
+// Orders are the valid values of Config.Order.
+var Orders = []string{OrderBFS, OrderDFS, OrderPriority}
+
+// frontierItem is a queued job with its precomputed rank.
+type frontierItem struct {
+	job   Job
+	score float64
+	seq   uint64 // insertion order, breaks ties first-in-first-out
+}
+
+// jobHeap is a max-heap on score for container/heap.
+type jobHeap []frontierItem
+
+func (h jobHeap) Len() int { return len(h) }
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].score != h[j].score {
+		return h[i].score > h[j].score
+	}
+	return h[i].seq < h[j].seq
+}
+func (h jobHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *jobHeap) Push(x any)   { *h = append(*h, x.(frontierItem)) }
+func (h *jobHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// frontier holds the URLs waiting to be fetched. Each host has its own
+// priority queue and hosts take turns, so a host with thousands of
+// queued links can't starve the others.
+type frontier struct {
+	score func(Job, uint64) float64
+
+	hosts map[string]*jobHeap
+	ring  []string // hosts with queued jobs, in turn order
+	turn  int      // index into ring of the host whose turn it is
+	seq   uint64
+	size  int
+}
+
+// newFrontier returns a frontier ranked by score if it is set, and by
+// order otherwise. Unknown orders fall back to OrderBFS.
+func newFrontier(order string, score func(Job) float64) *frontier {
+	f := &frontier{hosts: make(map[string]*jobHeap)}
+	switch {
+	case score != nil:
+		f.score = func(j Job, _ uint64) float64 { return score(j) }
+	case order == OrderDFS:
+		f.score = func(_ Job, seq uint64) float64 { return float64(seq) }
+	case order == OrderPriority:
+		f.score = priorityScore
+	default:
+		f.score = func(j Job, _ uint64) float64 { return -float64(j.Depth) }
+	}
+	return f
+}
+
+// priorityScore ranks sitemap priority first, then how recently the
+// page changed, then depth. Pages without a sitemap entry count as the
+// sitemap default of 0.5.
+func priorityScore(j Job, _ uint64) float64 {
+	p := 0.5
+	if j.Sitemap {
+		p = j.Priority
+	}
+	score := p * 1e6
+	if !j.LastMod.IsZero() {
+		// Up to 1000 points for freshness, fading over about three years.
+		age := time.Since(j.LastMod).Hours() / 24
+		score += max(0, 1000-age)
+	}
+	return score - float64(j.Depth)
+}
+
+func (f *frontier) Len() int { return f.size }
+
+// push queues j.
+func (f *frontier) push(j Job) {
+	host := hostOf(j.URL)
+	h, ok := f.hosts[host]
+	if !ok {
+		h = &jobHeap{}
+		f.hosts[host] = h
+	}
+	if h.Len() == 0 {
+		f.ring = append(f.ring, host)
+	}
+	f.seq++
+	heap.Push(h, frontierItem{job: j, score: f.score(j, f.seq), seq: f.seq})
+	f.size++
+}
+
+// peek returns the best job of the first host, starting with the host
+// whose turn it is, that ready allows to be fetched now. If none is
+// ready it returns ok=false and the shortest wait ready reported.
+func (f *frontier) peek(ready func(host string) (bool, time.Duration)) (job Job, ok bool, wait time.Duration) {
+	for i := range f.ring {
+		host := f.ring[(f.turn+i)%len(f.ring)]
+		r, w := ready(host)
+		if r {
+			return (*f.hosts[host])[0].job, true, 0
+		}
+		if w > 0 && (wait == 0 || w < wait) {
+			wait = w
+		}
+	}
+	return Job{}, false, wait
+}
+
+// pop removes the job peek returned for host and passes the turn on to
+// the next host.
+func (f *frontier) pop(host string) Job {
+	h := f.hosts[host]
+	item := heap.Pop(h).(frontierItem)
+	f.size--
+
+	i := 0
+	for f.ring[i] != host {
+		i++
+	}
+	if h.Len() == 0 {
+		f.ring = append(f.ring[:i], f.ring[i+1:]...)
+		delete(f.hosts, host)
+		f.turn = i // the next host slid into this slot
+	} else {
+		f.turn = i + 1
+	}
+	if len(f.ring) > 0 {
+		f.turn %= len(f.ring)
+	} else {
+		f.turn = 0
+	}
+	return item.job
+}
+
+// drain empties the frontier and returns its jobs, best first per host.
+func (f *frontier) drain() []Job {
+	jobs := make([]Job, 0, f.size)
+	for _, host := range f.ring {
+		h := f.hosts[host]
+		for h.Len() > 0 {
+			jobs = append(jobs, heap.Pop(h).(frontierItem).job)
+		}
+	}
+	f.hosts = make(map[string]*jobHeap)
+	f.ring, f.turn, f.size = nil, 0, 0
+	return jobs
+}
+
+// jobs returns a copy of every queued job without removing them.
+func (f *frontier) jobs() []Job {
+	jobs := make([]Job, 0, f.size)
+	for _, host := range f.ring {
+		for _, item := range *f.hosts[host] {
+			jobs = append(jobs, item.job)
+		}
+	}
+	return jobs
+}
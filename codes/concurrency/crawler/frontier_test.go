@@ -0,0 +1,99 @@
+package crawler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func alwaysReady(string) (bool, time.Duration) { return true, 0 }
+
+// popAll empties f in the order run would hand jobs out.
+func popAll(f *frontier) []string {
+	var got []string
+	for f.Len() > 0 {
+		j, ok, _ := f.peek(alwaysReady)
+		if !ok {
+			break
+		}
+		f.pop(hostOf(j.URL))
+		got = append(got, j.URL)
+	}
+	return got
+}
+
+func TestFrontierOrder(t *testing.T) {
+	jobs := []Job{
+		{URL: "https://a.test/1", Depth: 1},
+		{URL: "https://a.test/0", Depth: 0},
+		{URL: "https://a.test/2", Depth: 2},
+		{URL: "https://a.test/1b", Depth: 1},
+		{URL: "https://a.test/hi", Depth: 2, Sitemap: true, Priority: 0.9},
+		{URL: "https://a.test/lo", Depth: 0, Sitemap: true, Priority: 0},
+	}
+	tests := []struct {
+		order string
+		score func(Job) float64
+		want  []string
+	}{
+		{OrderBFS, nil, []string{"/0", "/lo", "/1", "/1b", "/2", "/hi"}},
+		{OrderDFS, nil, []string{"/lo", "/hi", "/1b", "/2", "/0", "/1"}},
+		{OrderPriority, nil, []string{"/hi", "/0", "/1", "/1b", "/2", "/lo"}},
+		{OrderBFS, func(j Job) float64 { return float64(len(j.URL)) }, []string{"/1b", "/hi", "/lo", "/1", "/0", "/2"}},
+	}
+	for _, tt := range tests {
+		f := newFrontier(tt.order, tt.score)
+		for _, j := range jobs {
+			f.push(j)
+		}
+		var want []string
+		for _, p := range tt.want {
+			want = append(want, "https://a.test"+p)
+		}
+		if got := popAll(f); !reflect.DeepEqual(got, want) {
+			t.Errorf("order %q: got %v want %v", tt.order, got, want)
+		}
+	}
+}
+
+func TestFrontierHostFairness(t *testing.T) {
+	f := newFrontier(OrderBFS, nil)
+	for _, p := range []string{"/1", "/2", "/3", "/4"} {
+		f.push(Job{URL: "https://big.test" + p})
+	}
+	f.push(Job{URL: "https://small.test/1"})
+	f.push(Job{URL: "https://other.test/1"})
+
+	want := []string{
+		"https://big.test/1", "https://small.test/1", "https://other.test/1",
+		"https://big.test/2", "https://big.test/3", "https://big.test/4",
+	}
+	if got := popAll(f); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
+func TestFrontierSkipsBusyHosts(t *testing.T) {
+	f := newFrontier(OrderBFS, nil)
+	f.push(Job{URL: "https://slow.test/"})
+	f.push(Job{URL: "https://fast.test/"})
+
+	ready := func(host string) (bool, time.Duration) {
+		if host == "slow.test" {
+			return false, time.Second
+		}
+		return true, 0
+	}
+	j, ok, _ := f.peek(ready)
+	if !ok || j.URL != "https://fast.test/" {
+		t.Fatalf("got %v ok=%v, want fast.test", j.URL, ok)
+	}
+	f.pop(hostOf(j.URL))
+
+	if _, ok, wait := f.peek(ready); ok || wait != time.Second {
+		t.Errorf("got ok=%v wait=%v, want a 1s wait", ok, wait)
+	}
+	if got := f.drain(); len(got) != 1 || f.Len() != 0 {
+		t.Errorf("drain returned %d jobs, %d left", len(got), f.Len())
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/foyez/golang/codes/concurrency/crawler
+
+go 1.24
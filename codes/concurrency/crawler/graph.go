@@ -0,0 +1,396 @@
+package crawler
+
+import (
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// GraphFormats are the formats WriteGraph supports.
+var GraphFormats = []string{"dot", "graphml", "json"}
+
+// Node is a URL in the link graph. Links to URLs the crawl didn't fetch
+// are kept, so every edge has both ends, but Crawled is false for them.
+type Node struct {
+	URL      string `json:"url"`
+	Crawled  bool   `json:"crawled"`
+	Status   int    `json:"status,omitempty"` // 0 if the fetch failed, was skipped or redirected
+	Error    string `json:"error,omitempty"`  // why it failed or was skipped
+	Depth    int    `json:"depth"`
+	Seed     bool   `json:"seed,omitempty"`
+	InDegree int    `json:"in_degree"` // distinct pages linking here
+}
+
+// Edge is a link from one page to another. The same two pages are
+// joined by one edge per distinct anchor text.
+type Edge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Text     string `json:"text,omitempty"`
+	Redirect bool   `json:"redirect,omitempty"` // From redirects to To
+}
+
+// Graph is the link graph of a crawl: a node for every URL fetched or
+// linked to, and an edge for every distinct link. Add results to it as
+// Run hands them out; it is not safe for concurrent use, which suits
+// Run's handle callback since Run calls that from one goroutine.
+type Graph struct {
+	stripTracking bool
+
+	nodes map[string]*Node
+	edges map[Edge]bool
+}
+
+// NewGraph returns an empty Graph for a crawl run with cfg. Nodes are
+// keyed by the URL the crawler deduplicated on, so a page reached by
+// two spellings of its URL, or with tracking parameters stripped under
+// cfg.StripTracking, is one node.
+func NewGraph(cfg Config) *Graph {
+	return &Graph{
+		stripTracking: cfg.StripTracking,
+		nodes:         make(map[string]*Node),
+		edges:         make(map[Edge]bool),
+	}
+}
+
+func (g *Graph) node(u string) *Node {
+	n, ok := g.nodes[u]
+	if !ok {
+		n = &Node{URL: u}
+		g.nodes[u] = n
+	}
+	return n
+}
+
+// link adds an edge from page to the normalized form of target.
+func (g *Graph) link(page, target, text string, redirect bool) {
+	u, err := normalizeURL(target, g.stripTracking)
+	if err != nil || u == page {
+		return
+	}
+	g.node(u)
+	g.edges[Edge{From: page, To: u, Text: text, Redirect: redirect}] = true
+}
+
+// Add records r as a node and its links as edges.
+func (g *Graph) Add(r Result) {
+	self := urlKey(r.URL, g.stripTracking)
+	n := g.node(self)
+	n.Crawled = true
+	n.Depth = r.Depth
+	n.Seed = r.Depth == 0 && r.Parent == ""
+	switch {
+	case r.Err != nil:
+		n.Error = r.Err.Error()
+	case r.Skipped != "":
+		n.Error = r.Skipped
+	}
+	if r.Page == nil {
+		return
+	}
+
+	page := self
+	if u, err := normalizeURL(r.Page.FinalURL, g.stripTracking); err == nil && u != self {
+		// The client followed a redirect, so the status, the body and
+		// its links are the target's; the edge records the redirect.
+		final := g.node(u)
+		final.Crawled = true
+		final.Status = r.Page.StatusCode
+		final.Depth = r.Depth
+		g.edges[Edge{From: self, To: u, Redirect: true}] = true
+		page = u
+	} else {
+		n.Status = r.Page.StatusCode
+	}
+	if link := redirectTarget(r.Page); link != "" {
+		g.link(page, link, "", true)
+	}
+	for _, a := range r.Anchors {
+		g.link(page, a.URL, a.Text, false)
+	}
+}
+
+// Nodes returns every node sorted by URL, with InDegree filled in.
+func (g *Graph) Nodes() []Node {
+	from := make(map[string]map[string]bool)
+	for e := range g.edges {
+		if from[e.To] == nil {
+			from[e.To] = make(map[string]bool)
+		}
+		from[e.To][e.From] = true
+	}
+
+	nodes := make([]Node, 0, len(g.nodes))
+	for u, n := range g.nodes {
+		node := *n
+		node.InDegree = len(from[u])
+		nodes = append(nodes, node)
+	}
+	slices.SortFunc(nodes, func(a, b Node) int { return strings.Compare(a.URL, b.URL) })
+	return nodes
+}
+
+// Edges returns every edge sorted by source, target and text.
+func (g *Graph) Edges() []Edge {
+	edges := make([]Edge, 0, len(g.edges))
+	for e := range g.edges {
+		edges = append(edges, e)
+	}
+	slices.SortFunc(edges, func(a, b Edge) int {
+		return cmp.Or(
+			strings.Compare(a.From, b.From),
+			strings.Compare(a.To, b.To),
+			strings.Compare(a.Text, b.Text),
+		)
+	})
+	return edges
+}
+
+// GraphSummary describes the structure of a crawled site.
+type GraphSummary struct {
+	Pages int // crawled URLs
+	Links int // edges
+
+	// Crawled pages with the most pages linking to them, most first.
+	TopLinked []Node
+
+	// Crawled pages no other page links to, except the seeds; usually
+	// found through a sitemap.
+	Orphans []string
+
+	// Depths[d] is the number of crawled pages d links from a seed.
+	Depths []int
+}
+
+// Summary works out the in-degree of each page, the orphan pages and
+// the depth distribution, listing at most top pages in TopLinked.
+func (g *Graph) Summary(top int) GraphSummary {
+	s := GraphSummary{Links: len(g.edges)}
+	var pages []Node
+	for _, n := range g.Nodes() {
+		if !n.Crawled {
+			continue
+		}
+		pages = append(pages, n)
+		if n.InDegree == 0 && !n.Seed {
+			s.Orphans = append(s.Orphans, n.URL)
+		}
+		for len(s.Depths) <= n.Depth {
+			s.Depths = append(s.Depths, 0)
+		}
+		s.Depths[n.Depth]++
+	}
+	s.Pages = len(pages)
+
+	slices.SortStableFunc(pages, func(a, b Node) int { return cmp.Compare(b.InDegree, a.InDegree) })
+	for _, n := range pages[:min(top, len(pages))] {
+		if n.InDegree == 0 {
+			break
+		}
+		s.TopLinked = append(s.TopLinked, n)
+	}
+	return s
+}
+
+// Print writes the summary as an aligned table.
+func (s GraphSummary) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintf(tw, "Pages\t%d\n", s.Pages)
+	fmt.Fprintf(tw, "Links\t%d\n", s.Links)
+	if len(s.TopLinked) > 0 {
+		fmt.Fprintf(tw, "Most linked\t\n")
+		for _, n := range s.TopLinked {
+			fmt.Fprintf(tw, "  %s\t%d\n", n.URL, n.InDegree)
+		}
+	}
+	fmt.Fprintf(tw, "Orphan pages\t%d\n", len(s.Orphans))
+	for _, u := range s.Orphans {
+		fmt.Fprintf(tw, "  %s\t\n", u)
+	}
+	fmt.Fprintf(tw, "Pages by depth\t\n")
+	for d, n := range s.Depths {
+		fmt.Fprintf(tw, "  %d\t%d\n", d, n)
+	}
+}
+
+// WriteGraph writes g as Graphviz DOT with format "dot", GraphML with
+// "graphml" and a JSON adjacency list with "json".
+func WriteGraph(w io.Writer, format string, g *Graph) error {
+	switch format {
+	case "dot":
+		return writeDOT(w, g)
+	case "graphml":
+		return writeGraphML(w, g)
+	case "json":
+		return writeGraphJSON(w, g)
+	}
+	return fmt.Errorf("unknown graph format %q (want one of %s)", format, strings.Join(GraphFormats, ", "))
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func dotQuote(s string) string { return `"` + dotEscaper.Replace(s) + `"` }
+
+// writeDOT labels each node with its URL and status. Broken pages are
+// red and URLs that weren't crawled are dashed.
+func writeDOT(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	b.WriteString("digraph crawl {\n\tnode [shape=box];\n")
+	for _, n := range g.Nodes() {
+		label := n.URL
+		switch {
+		case n.Status != 0:
+			label += fmt.Sprintf("\n%d", n.Status)
+		case n.Error != "":
+			label += "\n" + n.Error
+		}
+		attrs := []string{"label=" + dotQuote(label)}
+		if !n.Crawled {
+			attrs = append(attrs, "style=dashed")
+		} else if n.Error != "" || n.Status >= 400 {
+			attrs = append(attrs, "color=red")
+		}
+		fmt.Fprintf(&b, "\t%s [%s];\n", dotQuote(n.URL), strings.Join(attrs, ", "))
+	}
+	for _, e := range g.Edges() {
+		var attrs []string
+		if e.Text != "" {
+			attrs = append(attrs, "label="+dotQuote(e.Text))
+		}
+		if e.Redirect {
+			attrs = append(attrs, "style=dotted")
+		}
+		fmt.Fprintf(&b, "\t%s -> %s", dotQuote(e.From), dotQuote(e.To))
+		if len(attrs) > 0 {
+			fmt.Fprintf(&b, " [%s]", strings.Join(attrs, ", "))
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// The GraphML document: nodes and edges carry their fields as <data>
+// elements declared by <key>s.
+type (
+	graphML struct {
+		XMLName xml.Name     `xml:"graphml"`
+		XMLNS   string       `xml:"xmlns,attr"`
+		Keys    []graphMLKey `xml:"key"`
+		Graph   struct {
+			EdgeDefault string         `xml:"edgedefault,attr"`
+			Nodes       []graphMLEntry `xml:"node"`
+			Edges       []graphMLEntry `xml:"edge"`
+		} `xml:"graph"`
+	}
+	graphMLKey struct {
+		ID   string `xml:"id,attr"`
+		For  string `xml:"for,attr"`
+		Name string `xml:"attr.name,attr"`
+		Type string `xml:"attr.type,attr"`
+	}
+	graphMLEntry struct {
+		ID     string        `xml:"id,attr,omitempty"`
+		Source string        `xml:"source,attr,omitempty"`
+		Target string        `xml:"target,attr,omitempty"`
+		Data   []graphMLData `xml:"data"`
+	}
+	graphMLData struct {
+		Key   string `xml:"key,attr"`
+		Value string `xml:",chardata"`
+	}
+)
+
+func writeGraphML(w io.Writer, g *Graph) error {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{"url", "node", "url", "string"},
+			{"crawled", "node", "crawled", "boolean"},
+			{"status", "node", "status", "int"},
+			{"error", "node", "error", "string"},
+			{"depth", "node", "depth", "int"},
+			{"in_degree", "node", "in_degree", "int"},
+			{"text", "edge", "text", "string"},
+			{"redirect", "edge", "redirect", "boolean"},
+		},
+	}
+	doc.Graph.EdgeDefault = "directed"
+
+	// GraphML ids are plain names, so nodes are numbered and the URL
+	// goes in a data element.
+	ids := make(map[string]string)
+	for i, n := range g.Nodes() {
+		id := fmt.Sprintf("n%d", i)
+		ids[n.URL] = id
+		data := []graphMLData{
+			{"url", n.URL},
+			{"crawled", fmt.Sprint(n.Crawled)},
+			{"depth", fmt.Sprint(n.Depth)},
+			{"in_degree", fmt.Sprint(n.InDegree)},
+		}
+		if n.Status != 0 {
+			data = append(data, graphMLData{"status", fmt.Sprint(n.Status)})
+		}
+		if n.Error != "" {
+			data = append(data, graphMLData{"error", n.Error})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLEntry{ID: id, Data: data})
+	}
+	for _, e := range g.Edges() {
+		var data []graphMLData
+		if e.Text != "" {
+			data = append(data, graphMLData{"text", e.Text})
+		}
+		if e.Redirect {
+			data = append(data, graphMLData{"redirect", "true"})
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEntry{Source: ids[e.From], Target: ids[e.To], Data: data})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// graphLink is an entry in the JSON adjacency list.
+type graphLink struct {
+	URL      string `json:"url"`
+	Text     string `json:"text,omitempty"`
+	Redirect bool   `json:"redirect,omitempty"`
+}
+
+// writeGraphJSON writes {"nodes": [...], "adjacency": {url: [links]}},
+// with a (possibly empty) list of links for every node.
+func writeGraphJSON(w io.Writer, g *Graph) error {
+	nodes := g.Nodes()
+	adjacency := make(map[string][]graphLink, len(nodes))
+	for _, n := range nodes {
+		adjacency[n.URL] = []graphLink{}
+	}
+	for _, e := range g.Edges() {
+		adjacency[e.From] = append(adjacency[e.From], graphLink{URL: e.To, Text: e.Text, Redirect: e.Redirect})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Nodes     []Node                 `json:"nodes"`
+		Adjacency map[string][]graphLink `json:"adjacency"`
+	}{nodes, adjacency})
+}
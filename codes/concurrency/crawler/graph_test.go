@@ -0,0 +1,167 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func crawlGraph(t *testing.T, cfg Config, f Fetcher) *Graph {
+	t.Helper()
+	g := NewGraph(cfg)
+	newTestCrawler(cfg, f).Run(context.Background(), g.Add)
+	return g
+}
+
+func TestGraph(t *testing.T) {
+	f := newFakeFetcher(map[string][]fakeResponse{
+		site + "/":        fakeHTML(`<a href="/a">About</a> <a href="/b">Blog</a> <a href="/a">more</a> <a href="#top">top</a>`),
+		site + "/a":       fakeHTML(`<a href="/">Home</a> <a href="/b">Blog</a> <a href="/gone">Gone</a>`),
+		site + "/b":       fakeHTML(`<a href="/old">Old</a> <a href="https://other.test/">Other</a>`),
+		site + "/gone":    {{Status: http.StatusNotFound}},
+		site + "/old":     {{Status: http.StatusMovedPermanently, Header: http.Header{"Location": {"/a"}}}},
+		site + "/orphan":  fakeHTML(`<a href="/">Home</a>`),
+		site + "/map.xml": {{Body: `<urlset><url><loc>https://site.test/orphan</loc></url></urlset>`}},
+	})
+
+	g := crawlGraph(t, Config{MaxDepth: 3, IgnoreRobots: true, Sitemaps: []string{site + "/map.xml"}}, f)
+
+	var edges []string
+	for _, e := range g.Edges() {
+		edges = append(edges, fmt.Sprintf("%s>%s %q %v",
+			strings.TrimPrefix(e.From, site), strings.TrimPrefix(e.To, site), e.Text, e.Redirect))
+	}
+	want := []string{
+		`/>/a "About" false`,
+		`/>/a "more" false`,
+		`/>/b "Blog" false`,
+		`/a>/ "Home" false`,
+		`/a>/b "Blog" false`,
+		`/a>/gone "Gone" false`,
+		`/b>https://other.test/ "Other" false`,
+		`/b>/old "Old" false`,
+		`/old>/a "" true`,
+		`/orphan>/ "Home" false`,
+	}
+	if !slices.Equal(edges, want) {
+		t.Errorf("got edges\n%s\nwant\n%s", strings.Join(edges, "\n"), strings.Join(want, "\n"))
+	}
+
+	nodes := make(map[string]Node)
+	for _, n := range g.Nodes() {
+		nodes[strings.TrimPrefix(n.URL, site)] = n
+	}
+	if n := nodes["/a"]; n.InDegree != 2 || n.Status != 200 || n.Depth != 1 {
+		t.Errorf("got /a %+v", n)
+	}
+	if n := nodes["/gone"]; n.Status != 404 || !n.Crawled {
+		t.Errorf("got /gone %+v", n)
+	}
+	if n := nodes["https://other.test/"]; n.Crawled || n.InDegree != 1 {
+		t.Errorf("got other.test %+v", n)
+	}
+
+	s := g.Summary(2)
+	if s.Pages != 6 || s.Links != len(want) {
+		t.Errorf("got %d pages, %d links", s.Pages, s.Links)
+	}
+	if len(s.TopLinked) != 2 || s.TopLinked[0].URL != site+"/" || s.TopLinked[1].URL != site+"/a" {
+		t.Errorf("got top linked %+v", s.TopLinked)
+	}
+	if !slices.Equal(s.Orphans, []string{site + "/orphan"}) {
+		t.Errorf("got orphans %v", s.Orphans)
+	}
+	if !slices.Equal(s.Depths, []int{2, 2, 2}) {
+		t.Errorf("got depths %v", s.Depths)
+	}
+}
+
+func TestGraphFollowedRedirect(t *testing.T) {
+	g := NewGraph(Config{})
+	g.Add(Result{
+		URL: site + "/old",
+		Page: &Page{
+			URL:         site + "/old",
+			FinalURL:    site + "/new",
+			StatusCode:  200,
+			ContentType: "text/html",
+		},
+		Anchors: []Anchor{{URL: site + "/child", Text: "child"}},
+	})
+
+	edges := g.Edges()
+	if len(edges) != 2 ||
+		edges[0] != (Edge{From: site + "/new", To: site + "/child", Text: "child"}) ||
+		edges[1] != (Edge{From: site + "/old", To: site + "/new", Redirect: true}) {
+		t.Errorf("got edges %+v", edges)
+	}
+	nodes := g.Nodes()
+	if len(nodes) != 3 || nodes[1].URL != site+"/new" || nodes[1].Status != 200 ||
+		nodes[2].URL != site+"/old" || nodes[2].Status != 0 || !nodes[2].Crawled {
+		t.Errorf("got nodes %+v", nodes)
+	}
+}
+
+func TestWriteGraph(t *testing.T) {
+	g := NewGraph(Config{})
+	g.Add(Result{
+		URL:     site + "/",
+		Page:    &Page{URL: site + "/", FinalURL: site + "/", StatusCode: 200},
+		Anchors: []Anchor{{URL: site + "/a", Text: `say "hi"`}},
+	})
+	g.Add(Result{URL: site + "/a", Depth: 1, Parent: site + "/", Err: fmt.Errorf("connection refused")})
+
+	var dot bytes.Buffer
+	if err := WriteGraph(&dot, "dot", g); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`"https://site.test/" [label="https://site.test/\n200"];`,
+		`"https://site.test/a" [label="https://site.test/a\nconnection refused", color=red];`,
+		`"https://site.test/" -> "https://site.test/a" [label="say \"hi\""];`,
+	} {
+		if !strings.Contains(dot.String(), line) {
+			t.Errorf("DOT output lacks %s:\n%s", line, dot.String())
+		}
+	}
+
+	var graphml bytes.Buffer
+	if err := WriteGraph(&graphml, "graphml", g); err != nil {
+		t.Fatal(err)
+	}
+	var doc graphML
+	if err := xml.Unmarshal(graphml.Bytes(), &doc); err != nil {
+		t.Fatalf("GraphML doesn't parse: %v\n%s", err, graphml.String())
+	}
+	if len(doc.Graph.Nodes) != 2 || len(doc.Graph.Edges) != 1 ||
+		doc.Graph.Edges[0].Source != "n0" || doc.Graph.Edges[0].Target != "n1" {
+		t.Errorf("got GraphML %+v", doc.Graph)
+	}
+
+	var js bytes.Buffer
+	if err := WriteGraph(&js, "json", g); err != nil {
+		t.Fatal(err)
+	}
+	var adj struct {
+		Nodes     []Node                 `json:"nodes"`
+		Adjacency map[string][]graphLink `json:"adjacency"`
+	}
+	if err := json.Unmarshal(js.Bytes(), &adj); err != nil {
+		t.Fatal(err)
+	}
+	if len(adj.Nodes) != 2 || adj.Nodes[1].InDegree != 1 ||
+		len(adj.Adjacency[site+"/"]) != 1 || adj.Adjacency[site+"/"][0].Text != `say "hi"` ||
+		adj.Adjacency[site+"/a"] == nil {
+		t.Errorf("got JSON %s", js.String())
+	}
+
+	if err := WriteGraph(&js, "svg", g); err == nil {
+		t.Error("unknown format should fail")
+	}
+}
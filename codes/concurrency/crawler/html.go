@@ -0,0 +1,307 @@
+package crawler
+
+import (
+	"bytes"
+	"cmp"
+	"html"
+	"net/url"
+	"strings"
+)
+
+// TokenKind says whether a Token is text, a start tag or an end tag.
+type TokenKind int
+
+const (
+	TextToken TokenKind = iota
+	StartTagToken
+	EndTagToken
+)
+
+// Token is one piece of an HTML document: a run of text or a tag. Self-
+// closing tags come through as start tags, and the contents of <script>
+// and <style> are dropped.
+type Token struct {
+	Kind  TokenKind
+	Tag   string            // lower-case tag name
+	Attrs map[string]string // lower-case attribute names, unescaped values
+	Text  string            // unescaped text for TextToken
+}
+
+// rawTextTags hold content that must not be parsed as markup.
+var rawTextTags = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"textarea": true,
+	"title":    true,
+}
+
+// tokenizeHTML walks body and calls fn for every tag and text run.
+// It is a small, forgiving tokenizer: good enough to pull links and
+// metadata out of real pages without a third-party parser.
+func tokenizeHTML(body []byte, fn func(Token)) {
+	for len(body) > 0 {
+		lt := bytes.IndexByte(body, '<')
+		if lt < 0 {
+			emitText(body, fn)
+			return
+		}
+		if lt > 0 {
+			emitText(body[:lt], fn)
+			body = body[lt:]
+		}
+
+		switch {
+		case bytes.HasPrefix(body, []byte("<!--")):
+			end := bytes.Index(body[4:], []byte("-->"))
+			if end < 0 {
+				return
+			}
+			body = body[4+end+3:]
+			continue
+		case len(body) > 1 && (body[1] == '!' || body[1] == '?'):
+			end := bytes.IndexByte(body, '>')
+			if end < 0 {
+				return
+			}
+			body = body[end+1:]
+			continue
+		}
+
+		tok, rest, ok := parseTag(body)
+		if !ok {
+			if rest == nil {
+				// The tag runs to the end of the page, say through an
+				// unclosed quote. Browsers drop it, and so do we, rather
+				// than rescanning from every '<' inside it.
+				return
+			}
+			// A lone '<' is just text.
+			emitText(body[:1], fn)
+			body = rest
+			continue
+		}
+		body = rest
+		fn(tok)
+
+		if tok.Kind == StartTagToken && rawTextTags[tok.Tag] {
+			closing := []byte("</" + tok.Tag)
+			end := indexFold(body, closing)
+			if end < 0 {
+				end = len(body)
+			}
+			if tok.Tag == "title" || tok.Tag == "textarea" {
+				emitText(body[:end], fn)
+			}
+			body = body[end:]
+		}
+	}
+}
+
+func emitText(b []byte, fn func(Token)) {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return
+	}
+	fn(Token{Kind: TextToken, Text: html.UnescapeString(string(b))})
+}
+
+// parseTag parses a start or end tag at the beginning of b. If b
+// doesn't start with a tag, ok is false and rest is what follows the
+// '<'; if the tag is cut off by the end of b, rest is nil as well.
+func parseTag(b []byte) (tok Token, rest []byte, ok bool) {
+	i := 1
+	kind := StartTagToken
+	if i < len(b) && b[i] == '/' {
+		kind = EndTagToken
+		i++
+	}
+	start := i
+	for i < len(b) && isNameByte(b[i]) {
+		i++
+	}
+	if i == start {
+		return Token{}, b[1:], false
+	}
+	tok = Token{Kind: kind, Tag: strings.ToLower(string(b[start:i]))}
+
+	for i < len(b) {
+		for i < len(b) && (isSpace(b[i]) || b[i] == '/') {
+			i++
+		}
+		if i >= len(b) {
+			break
+		}
+		if b[i] == '>' {
+			return tok, b[i+1:], true
+		}
+
+		nameStart := i
+		for i < len(b) && !isSpace(b[i]) && b[i] != '=' && b[i] != '>' && b[i] != '/' {
+			i++
+		}
+		name := strings.ToLower(string(b[nameStart:i]))
+		for i < len(b) && isSpace(b[i]) {
+			i++
+		}
+
+		value := ""
+		if i < len(b) && b[i] == '=' {
+			i++
+			for i < len(b) && isSpace(b[i]) {
+				i++
+			}
+			if i < len(b) && (b[i] == '"' || b[i] == '\'') {
+				quote := b[i]
+				end := bytes.IndexByte(b[i+1:], quote)
+				if end < 0 {
+					return Token{}, nil, false
+				}
+				value = string(b[i+1 : i+1+end])
+				i += end + 2
+			} else {
+				valStart := i
+				for i < len(b) && !isSpace(b[i]) && b[i] != '>' {
+					i++
+				}
+				value = string(b[valStart:i])
+			}
+		}
+
+		if tok.Attrs == nil {
+			tok.Attrs = make(map[string]string)
+		}
+		if _, dup := tok.Attrs[name]; !dup {
+			tok.Attrs[name] = html.UnescapeString(value)
+		}
+	}
+	return Token{}, nil, false
+}
+
+func isNameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == ':'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// indexFold is bytes.Index with ASCII case folding.
+func indexFold(s, sep []byte) int {
+	for i := 0; i+len(sep) <= len(s); i++ {
+		if bytes.EqualFold(s[i:i+len(sep)], sep) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Anchor is an <a href> link found on a page.
+type Anchor struct {
+	URL      string // absolute http(s) URL without the fragment
+	Fragment string // the part after '#', if any
+	Text     string // link text with whitespace collapsed
+}
+
+// extractAnchors returns every <a href> in body that points at an
+// http(s) URL, resolved against base (or the page's <base href> if
+// present). Links to a fragment of the page itself are included.
+func extractAnchors(base *url.URL, body []byte) []Anchor {
+	var anchors []Anchor
+	open := -1 // index of the <a> whose text is being collected
+	var text []string
+	closeAnchor := func() {
+		if open >= 0 && anchors[open].Text == "" {
+			anchors[open].Text = strings.Join(strings.Fields(strings.Join(text, " ")), " ")
+		}
+		open, text = -1, nil
+	}
+
+	tokenizeHTML(body, func(tok Token) {
+		switch {
+		case tok.Kind == TextToken:
+			if open >= 0 {
+				text = append(text, tok.Text)
+			}
+		case tok.Kind == EndTagToken && tok.Tag == "a":
+			closeAnchor()
+		case tok.Kind != StartTagToken:
+		case tok.Tag == "base":
+			if href, ok := tok.Attrs["href"]; ok {
+				if u, err := base.Parse(strings.TrimSpace(href)); err == nil {
+					base = u
+				}
+			}
+		case tok.Tag == "img" && open >= 0:
+			text = append(text, tok.Attrs["alt"])
+		case tok.Tag == "a":
+			closeAnchor()
+			href, ok := tok.Attrs["href"]
+			if !ok {
+				return
+			}
+			a, ok := resolveAnchor(base, href)
+			if !ok {
+				return
+			}
+			// Used when the link has no text of its own.
+			a.Text = cmp.Or(tok.Attrs["aria-label"], tok.Attrs["title"])
+			anchors = append(anchors, a)
+			open = len(anchors) - 1
+		}
+	})
+	closeAnchor()
+	return anchors
+}
+
+// anchorURLs returns the URL of each anchor that doesn't point back at
+// page.
+func anchorURLs(anchors []Anchor, page string) []string {
+	if u, err := url.Parse(page); err == nil {
+		u.Fragment, u.RawFragment = "", ""
+		page = u.String()
+	}
+	var links []string
+	for _, a := range anchors {
+		if a.URL != page {
+			links = append(links, a.URL)
+		}
+	}
+	return links
+}
+
+// resolveAnchor resolves href against base and splits off its fragment.
+func resolveAnchor(base *url.URL, href string) (Anchor, bool) {
+	href = strings.TrimSpace(href)
+	if href == "" {
+		return Anchor{}, false
+	}
+	u, err := base.Parse(href)
+	if err != nil {
+		return Anchor{}, false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return Anchor{}, false
+	}
+	a := Anchor{Fragment: u.Fragment}
+	u.Fragment = ""
+	u.RawFragment = ""
+	a.URL = u.String()
+	return a, true
+}
+
+// extractIDs returns the fragment targets on a page: every id attribute
+// and the name of every <a name>.
+func extractIDs(body []byte) map[string]bool {
+	ids := make(map[string]bool)
+	tokenizeHTML(body, func(tok Token) {
+		if tok.Kind != StartTagToken {
+			return
+		}
+		if id := tok.Attrs["id"]; id != "" {
+			ids[id] = true
+		}
+		if name := tok.Attrs["name"]; name != "" && tok.Tag == "a" {
+			ids[name] = true
+		}
+	})
+	return ids
+}
@@ -0,0 +1,112 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tokens renders what tokenizeHTML finds in body, one token per entry:
+// "<a href=/x>", "</a>" or "text".
+func tokens(body string) []string {
+	var out []string
+	tokenizeHTML([]byte(body), func(tok Token) {
+		switch tok.Kind {
+		case TextToken:
+			out = append(out, strings.TrimSpace(tok.Text))
+		case EndTagToken:
+			out = append(out, "</"+tok.Tag+">")
+		default:
+			var attrs []string
+			for k, v := range tok.Attrs {
+				attrs = append(attrs, k+"="+v)
+			}
+			sort.Strings(attrs)
+			out = append(out, "<"+strings.Join(append([]string{tok.Tag}, attrs...), " ")+">")
+		}
+	})
+	return out
+}
+
+func TestTokenizeHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"tags and text", `<P Class="x">Hi</p>`, []string{"<p class=x>", "Hi", "</p>"}},
+		{"unquoted attributes", `<a href=/x title=go>`, []string{"<a href=/x title=go>"}},
+		{"single quotes", `<a href='/x y'>`, []string{"<a href=/x y>"}},
+		{"bare attribute", `<input disabled type=checkbox/>`, []string{"<input disabled= type=checkbox/>"}},
+		{"first duplicate attribute wins", `<a href="/1" HREF="/2">`, []string{"<a href=/1>"}},
+		{"entities in text and attributes", `<a title="a &amp; b">&lt;tag&gt; &eacute;</a>`, []string{"<a title=a & b>", "<tag> é", "</a>"}},
+		{"skips script", `<script>if (a<b) { x = "</p>" }</script>after`, []string{"<script>", "</script>", "after"}},
+		{"skips style", `<STYLE>a > b { color: red }</style>after`, []string{"<style>", "</style>", "after"}},
+		{"keeps title text", `<title>A &amp; B</title>`, []string{"<title>", "A & B", "</title>"}},
+		{"skips comments", `a<!-- <a href="/hidden"> -->b`, []string{"a", "b"}},
+		{"skips doctype", `<!DOCTYPE html><?xml version="1.0"?><p>`, []string{"<p>"}},
+		{"lone angle bracket is text", `1 < 2`, []string{"1", "<", "2"}},
+		{"unterminated quote drops the rest", `<p>ok</p><a x="<b>lost`, []string{"<p>", "ok", "</p>"}},
+		{"unterminated comment drops the rest", `ok<!-- <a href="/x">`, []string{"ok"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokens(tt.in); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenizeHTMLUnterminatedIsLinear(t *testing.T) {
+	// Every '<' here starts a tag with an unclosed quote. Rescanning
+	// from each one would take seconds.
+	body := []byte(strings.Repeat(`<a x="`, 200_000))
+	start := time.Now()
+	tokenizeHTML(body, func(Token) {})
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("took %v", d)
+	}
+}
+
+func TestExtractAnchors(t *testing.T) {
+	base, _ := url.Parse("https://site.test/dir/page.html")
+	tests := []struct {
+		name string
+		in   string
+		want []string // "URL#fragment text"
+	}{
+		{"resolves relative links", `<a href="other.html">Other</a> <a href="/root">Root</a>`,
+			[]string{"https://site.test/dir/other.html# Other", "https://site.test/root# Root"}},
+		{"base href", `<base href="https://cdn.test/docs/"><a href="x">X</a>`,
+			[]string{"https://cdn.test/docs/x# X"}},
+		{"relative base href", `<base href="/v2/"><a href="x">X</a>`,
+			[]string{"https://site.test/v2/x# X"}},
+		{"unquoted href", `<a href=/x?a=1>X</a>`, []string{"https://site.test/x?a=1# X"}},
+		{"splits fragment", `<a href="#top">Top</a><a href="/a#b">A</a>`,
+			[]string{"https://site.test/dir/page.html#top Top", "https://site.test/a#b A"}},
+		{"collapses whitespace", "<a href=/x>\n  two\t words </a>", []string{"https://site.test/x# two words"}},
+		{"nested markup and entities", `<a href=/x><b>Fish</b> &amp; <i>chips</i></a>`, []string{"https://site.test/x# Fish & chips"}},
+		{"img alt as text", `<a href=/x><img src=logo.png alt="Home"></a>`, []string{"https://site.test/x# Home"}},
+		{"aria-label fallback", `<a href=/x aria-label="Close"><svg></svg></a>`, []string{"https://site.test/x# Close"}},
+		{"skips non-http", `<a href="mailto:a@b.test">m</a><a href="javascript:void(0)">j</a><a>none</a>`, nil},
+		{"skips links in script", `<script>document.write('<a href="/s">s</a>')</script><a href=/x>X</a>`,
+			[]string{"https://site.test/x# X"}},
+		{"unclosed anchor", `<a href=/a>A<a href=/b>B`, []string{"https://site.test/a# A", "https://site.test/b# B"}},
+		{"unterminated attribute", `<a href=/a>A</a><a x="`, []string{"https://site.test/a# A"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, a := range extractAnchors(base, []byte(tt.in)) {
+				got = append(got, fmt.Sprintf("%s#%s %s", a.URL, a.Fragment, a.Text))
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q want %q", got, tt.want)
+			}
+		})
+	}
+}
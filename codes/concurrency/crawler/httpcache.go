@@ -0,0 +1,184 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheHeader is set on responses that CachingTransport answered from
+// disk after a 304. fetch turns it into Page.FromCache.
+const cacheHeader = "X-Crawler-Cache"
+
+// cacheEntry is a stored response, one JSON file per URL.
+type cacheEntry struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	StoredAt   time.Time   `json:"stored_at"`
+}
+
+// CachingTransport keeps successful GET responses that carry an ETag or
+// Last-Modified in a directory. Later requests for the same URL are
+// sent with If-None-Match or If-Modified-Since, and a 304 is answered
+// with the stored body.
+type CachingTransport struct {
+	next http.RoundTripper
+	dir  string
+}
+
+// NewCachingTransport keeps its entries in dir, creating it if needed.
+func NewCachingTransport(next http.RoundTripper, dir string) (*CachingTransport, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &CachingTransport{next: next, dir: dir}, nil
+}
+
+func (t *CachingTransport) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(t.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// load returns the entry for url, or nil if there is none. A corrupt
+// entry counts as a miss and is overwritten on the next store.
+func (t *CachingTransport) load(url string) *cacheEntry {
+	data, err := os.ReadFile(t.path(url))
+	if err != nil {
+		return nil
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil || e.URL != url {
+		return nil
+	}
+	return &e
+}
+
+// store writes e atomically, so concurrent fetches of one URL can't
+// leave a torn file behind.
+func (t *CachingTransport) store(e *cacheEntry) error {
+	f, err := os.CreateTemp(t.dir, "entry.tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := json.NewEncoder(f).Encode(e); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), t.path(e.URL))
+}
+
+func (t *CachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.next.RoundTrip(req)
+	}
+	url := req.URL.String()
+
+	entry := t.load(url)
+	if entry != nil && req.Header.Get("If-None-Match") == "" && req.Header.Get("If-Modified-Since") == "" {
+		req = req.Clone(req.Context())
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lm := entry.Header.Get("Last-Modified"); lm != "" {
+			req.Header.Set("If-Modified-Since", lm)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && entry != nil:
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		// A 304 may carry fresher headers than the stored ones.
+		for k, v := range resp.Header {
+			if k != "Content-Length" {
+				entry.Header[k] = v
+			}
+		}
+		entry.StoredAt = time.Now().UTC()
+		t.store(entry)
+
+		header := entry.Header.Clone()
+		header.Set(cacheHeader, "hit")
+		return &http.Response{
+			Status:        strconv.Itoa(entry.StatusCode) + " " + http.StatusText(entry.StatusCode),
+			StatusCode:    entry.StatusCode,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(entry.Body)),
+			ContentLength: int64(len(entry.Body)),
+			Request:       req,
+		}, nil
+
+	case resp.StatusCode == http.StatusOK && cacheable(resp.Header):
+		resp.Body = &cacheWriter{
+			ReadCloser: resp.Body,
+			t:          t,
+			entry:      cacheEntry{URL: url, StatusCode: resp.StatusCode, Header: resp.Header.Clone()},
+		}
+	}
+	return resp, nil
+}
+
+// cacheable reports whether a response has a validator to revalidate
+// it with and may be stored.
+func cacheable(h http.Header) bool {
+	if strings.Contains(strings.ToLower(h.Get("Cache-Control")), "no-store") {
+		return false
+	}
+	return h.Get("ETag") != "" || h.Get("Last-Modified") != ""
+}
+
+// cacheWriter copies a response body as it is read and stores it when
+// the body is closed, but only if it was read to the end: a body cut
+// short by the size cap or an error is not worth keeping.
+type cacheWriter struct {
+	io.ReadCloser
+	t     *CachingTransport
+	entry cacheEntry
+	buf   bytes.Buffer
+	done  bool
+}
+
+func (w *cacheWriter) Read(p []byte) (int, error) {
+	n, err := w.ReadCloser.Read(p)
+	w.buf.Write(p[:n])
+	if errors.Is(err, io.EOF) {
+		w.done = true
+	}
+	return n, err
+}
+
+func (w *cacheWriter) Close() error {
+	err := w.ReadCloser.Close()
+	if w.done {
+		w.done = false
+		w.entry.Body = w.buf.Bytes()
+		w.entry.StoredAt = time.Now().UTC()
+		w.t.store(&w.entry)
+	}
+	return err
+}
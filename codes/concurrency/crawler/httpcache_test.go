@@ -0,0 +1,90 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCachingTransport(t *testing.T) {
+	var bodies atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/etag":
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/modified":
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+			if r.Header.Get("If-Modified-Since") != "" {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/plain":
+			// No validator, so nothing to cache.
+		}
+		bodies.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, "body of "+r.URL.Path)
+	}))
+	defer ts.Close()
+
+	cache, err := NewCachingTransport(ts.Client().Transport, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newHTTPFetcher(&http.Client{Transport: cache}, "gocrawler/1.0", 0)
+
+	for _, path := range []string{"/etag", "/modified", "/plain"} {
+		bodies.Store(0)
+		for i, wantCached := range []bool{false, path != "/plain"} {
+			page, err := f.Fetch(context.Background(), ts.URL+path)
+			if err != nil {
+				t.Fatalf("%s #%d: %v", path, i, err)
+			}
+			if page.StatusCode != http.StatusOK || string(page.Body) != "body of "+path {
+				t.Errorf("%s #%d: got %d %q", path, i, page.StatusCode, page.Body)
+			}
+			if page.FromCache != wantCached {
+				t.Errorf("%s #%d: FromCache = %v want %v", path, i, page.FromCache, wantCached)
+			}
+			if page.ContentType != "text/html" || page.Header.Get(cacheHeader) != "" {
+				t.Errorf("%s #%d: got content type %q, header %v", path, i, page.ContentType, page.Header)
+			}
+		}
+		want := int32(1)
+		if path == "/plain" {
+			want = 2
+		}
+		if bodies.Load() != want {
+			t.Errorf("%s: server sent %d bodies, want %d", path, bodies.Load(), want)
+		}
+	}
+}
+
+func TestCachingTransportSkipsTruncatedBodies(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"big"`)
+		if r.Header.Get("If-None-Match") != "" {
+			t.Errorf("a truncated body was cached")
+		}
+		io.WriteString(w, "0123456789")
+	}))
+	defer ts.Close()
+
+	cache, err := NewCachingTransport(ts.Client().Transport, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newHTTPFetcher(&http.Client{Transport: cache}, "", 4)
+	for range 2 {
+		if page, err := f.Fetch(context.Background(), ts.URL); err != nil || !page.Truncated {
+			t.Fatalf("got %+v, %v; want a truncated page", page, err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// The limits a Result or Summary can report as having fired.
+const (
+	LimitConnect   = "connect"  // Timeouts.Connect
+	LimitTLS       = "tls"      // Timeouts.TLS
+	LimitFirstByte = "ttfb"     // Timeouts.FirstByte
+	LimitBody      = "body"     // Timeouts.Body
+	LimitTimeout   = "timeout"  // the client's overall per-request timeout
+	LimitDeadline  = "deadline" // Config.Deadline
+	LimitBudget    = "budget"   // Config.MaxBytes
+)
+
+// Timeouts bound each phase of a request. Zero means no limit; the
+// client's overall timeout still applies on top.
+type Timeouts struct {
+	Connect   time.Duration // establishing the TCP connection
+	TLS       time.Duration // the TLS handshake
+	FirstByte time.Duration // from sending the request to the first response byte
+	Body      time.Duration // reading the response body
+}
+
+// limitError is the context cause when one of the limits above cuts a
+// request or the whole crawl short.
+type limitError struct {
+	Limit string
+	After time.Duration // the configured duration, for time limits
+}
+
+func (e *limitError) Error() string {
+	if e.After > 0 {
+		return fmt.Sprintf("%s limit of %v exceeded", e.Limit, e.After)
+	}
+	return e.Limit + " limit exceeded"
+}
+
+var (
+	errCrawlDeadline = &limitError{Limit: LimitDeadline}
+	errByteBudget    = &limitError{Limit: LimitBudget}
+)
+
+// limitOf names the limit that made err happen, or returns "" if err
+// isn't a timeout.
+func limitOf(err error) string {
+	var le *limitError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &le):
+		return le.Limit
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return LimitTimeout
+	}
+	return ""
+}
+
+// phaseTimers cancels a request's context with a limitError when one
+// of its phases runs too long. A phase that is already being timed
+// isn't restarted, even if httptrace reports it several times (as with
+// parallel dials); once it ends it can be timed afresh, as it is on
+// each hop of a redirect.
+type phaseTimers struct {
+	cancel context.CancelCauseFunc
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func (p *phaseTimers) start(limit string, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.timers[limit]; ok {
+		return
+	}
+	p.timers[limit] = time.AfterFunc(d, func() { p.cancel(&limitError{Limit: limit, After: d}) })
+}
+
+func (p *phaseTimers) stop(limit string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if t, ok := p.timers[limit]; ok {
+		t.Stop()
+		delete(p.timers, limit)
+	}
+}
+
+func (p *phaseTimers) stopAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, t := range p.timers {
+		t.Stop()
+	}
+}
+
+// withTimeouts returns a context for one request that is cancelled
+// when a phase in t runs over. Call stop once the body has been read;
+// if the request failed, context.Cause on the returned context says
+// which limit fired.
+func withTimeouts(ctx context.Context, t Timeouts) (reqCtx context.Context, p *phaseTimers, stop func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	p = &phaseTimers{cancel: cancel, timers: make(map[string]*time.Timer)}
+	trace := &httptrace.ClientTrace{
+		ConnectStart: func(string, string) { p.start(LimitConnect, t.Connect) },
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				p.stop(LimitConnect)
+			}
+		},
+		TLSHandshakeStart:    func() { p.start(LimitTLS, t.TLS) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { p.stop(LimitTLS) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { p.start(LimitFirstByte, t.FirstByte) },
+		GotFirstResponseByte: func() { p.stop(LimitFirstByte) },
+	}
+	return httptrace.WithClientTrace(ctx, trace), p, func() {
+		p.stopAll()
+		cancel(nil)
+	}
+}
+
+// limitCause returns the limitError that cancelled reqCtx, or err if no
+// phase limit fired. A cancelled parent ctx is left as it is, so the
+// crawl can still tell its own cancellation apart.
+func limitCause(ctx, reqCtx context.Context, err error) error {
+	var le *limitError
+	if ctx.Err() == nil && errors.As(context.Cause(reqCtx), &le) {
+		return fmt.Errorf("%w: %w", le, err)
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchPhaseTimeouts(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/slow-start", http.StatusFound)
+			return
+		case "/slow-start":
+			time.Sleep(200 * time.Millisecond)
+		case "/slow-body":
+			io.WriteString(w, "partial")
+			w.(http.Flusher).Flush()
+			time.Sleep(200 * time.Millisecond)
+		}
+		io.WriteString(w, "done")
+	}))
+	defer ts.Close()
+
+	// Accepts connections but never answers, so a TLS handshake hangs.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+
+	f := newHTTPFetcher(ts.Client(), "", 0)
+	f.timeouts = Timeouts{TLS: 50 * time.Millisecond, FirstByte: 50 * time.Millisecond, Body: 50 * time.Millisecond}
+	for _, tt := range []struct {
+		url, limit string
+	}{
+		{ts.URL + "/", ""},
+		{ts.URL + "/slow-start", LimitFirstByte},
+		{ts.URL + "/redirect", LimitFirstByte}, // timed again on the second hop
+		{ts.URL + "/slow-body", LimitBody},
+		{"https://" + ln.Addr().String() + "/", LimitTLS},
+	} {
+		_, err := f.Fetch(context.Background(), tt.url)
+		if got := limitOf(err); got != tt.limit {
+			t.Errorf("%s: got limit %q (err %v) want %q", tt.url, got, err, tt.limit)
+		}
+	}
+}
+
+func TestCrawlLimits(t *testing.T) {
+	responses := map[string][]fakeResponse{}
+	var links strings.Builder
+	for i := range 20 {
+		u := fmt.Sprintf("%s/p%d", site, i)
+		fmt.Fprintf(&links, `<a href="%s">%d</a>`, u, i)
+		responses[u] = []fakeResponse{{Body: "0123456789", Delay: 20 * time.Millisecond}}
+	}
+	responses[site+"/"] = fakeHTML(links.String())
+
+	for _, tt := range []struct {
+		cfg   Config
+		limit string
+	}{
+		{Config{Deadline: 50 * time.Millisecond}, LimitDeadline},
+		{Config{MaxBytes: int64(links.Len()) + 30}, LimitBudget},
+	} {
+		tt.cfg.MaxDepth, tt.cfg.Workers = 1, 2
+		var results []Result
+		sum := newTestCrawler(tt.cfg, newFakeFetcher(responses)).Run(context.Background(), func(r Result) {
+			results = append(results, r)
+		})
+		if sum.Limit != tt.limit {
+			t.Errorf("got limit %q want %q", sum.Limit, tt.limit)
+		}
+		if sum.Unfetched == 0 || len(results)+sum.Unfetched != 21 {
+			t.Errorf("%s: %d results, %d unfetched; want 21 in all with some unfetched", tt.limit, len(results), sum.Unfetched)
+		}
+		for _, r := range results {
+			if r.Err != nil {
+				t.Errorf("%s: %s reported as failed: %v", tt.limit, r.URL, r.Err)
+			}
+		}
+	}
+}
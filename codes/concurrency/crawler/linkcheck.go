@@ -0,0 +1,183 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// LinkRef is one place a link appears.
+type LinkRef struct {
+	Page string `json:"page"`
+	Text string `json:"text,omitempty"`
+}
+
+// BrokenLink is a link that doesn't work, with every page linking to it.
+type BrokenLink struct {
+	URL      string    `json:"url"`
+	Fragment string    `json:"fragment,omitempty"` // set when only the #fragment is missing
+	Reason   string    `json:"reason"`
+	Refs     []LinkRef `json:"referrers"`
+}
+
+// LinkChecker collects crawl results and works out which links are
+// broken. Feed it from Run's handle callback; it does no locking.
+type LinkChecker struct {
+	stripTracking bool
+
+	refs   map[string]map[string]map[LinkRef]bool // URL -> fragment -> referrers
+	status map[string]string                      // URL -> why it is broken; "" if it works
+	ids    map[string]map[string]bool             // URL -> fragment targets on the page
+}
+
+// NewLinkChecker returns a LinkChecker for a crawl run with cfg. A link
+// is matched to the fetch that answers it by normalizing both as the
+// crawler does, cfg.StripTracking included.
+func NewLinkChecker(cfg Config) *LinkChecker {
+	return &LinkChecker{
+		stripTracking: cfg.StripTracking,
+		refs:          make(map[string]map[string]map[LinkRef]bool),
+		status:        make(map[string]string),
+		ids:           make(map[string]map[string]bool),
+	}
+}
+
+// Add records the outcome of fetching r.URL and the links found on it.
+// Skipped URLs are neither working nor broken and are left out.
+func (lc *LinkChecker) Add(r Result) {
+	if r.Skipped != "" {
+		return
+	}
+
+	reason := ""
+	switch {
+	case r.Err != nil:
+		reason = r.Err.Error()
+	case r.Page.StatusCode >= 400:
+		reason = r.Page.Status
+	}
+	self := urlKey(r.URL, lc.stripTracking)
+	keys := []string{self}
+	if r.Page != nil {
+		if u, err := normalizeURL(r.Page.FinalURL, lc.stripTracking); err == nil && u != self {
+			// Links to the redirect target were deduplicated against it.
+			keys = append(keys, u)
+		}
+	}
+	for _, key := range keys {
+		lc.status[key] = reason
+		if reason == "" && r.Page.IsHTML() && len(r.Page.Body) > 0 {
+			lc.ids[key] = extractIDs(r.Page.Body)
+		}
+	}
+
+	for _, a := range r.Anchors {
+		u, err := normalizeURL(a.URL, lc.stripTracking)
+		if err != nil {
+			continue
+		}
+		if lc.refs[u] == nil {
+			lc.refs[u] = make(map[string]map[LinkRef]bool)
+		}
+		if lc.refs[u][a.Fragment] == nil {
+			lc.refs[u][a.Fragment] = make(map[LinkRef]bool)
+		}
+		lc.refs[u][a.Fragment][LinkRef{Page: r.URL, Text: a.Text}] = true
+	}
+}
+
+// Broken returns the broken links sorted by URL. A link to a page that
+// works is broken if its #fragment matches no id on that page; pages
+// fetched without a body (HEAD) can't be checked for fragments.
+func (lc *LinkChecker) Broken() []BrokenLink {
+	var broken []BrokenLink
+	for u, byFragment := range lc.refs {
+		reason, checked := lc.status[u]
+		if !checked {
+			continue
+		}
+		if reason != "" {
+			all := make(map[LinkRef]bool)
+			for _, refs := range byFragment {
+				for ref := range refs {
+					all[ref] = true
+				}
+			}
+			broken = append(broken, BrokenLink{URL: u, Reason: reason, Refs: sortedRefs(all)})
+			continue
+		}
+
+		ids, ok := lc.ids[u]
+		if !ok {
+			continue
+		}
+		for frag, refs := range byFragment {
+			// An empty fragment and "top" always scroll to the top.
+			if frag == "" || frag == "top" || ids[frag] {
+				continue
+			}
+			broken = append(broken, BrokenLink{
+				URL:      u,
+				Fragment: frag,
+				Reason:   "no element with id " + frag,
+				Refs:     sortedRefs(refs),
+			})
+		}
+	}
+	sort.Slice(broken, func(i, j int) bool {
+		if broken[i].URL != broken[j].URL {
+			return broken[i].URL < broken[j].URL
+		}
+		return broken[i].Fragment < broken[j].Fragment
+	})
+	return broken
+}
+
+func sortedRefs(set map[LinkRef]bool) []LinkRef {
+	refs := make([]LinkRef, 0, len(set))
+	for ref := range set {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Page != refs[j].Page {
+			return refs[i].Page < refs[j].Page
+		}
+		return refs[i].Text < refs[j].Text
+	})
+	return refs
+}
+
+// WriteBrokenLinks reports broken as JSON Lines with format "jsonl" and
+// as indented text otherwise.
+func WriteBrokenLinks(w io.Writer, format string, broken []BrokenLink) error {
+	if format == "jsonl" {
+		enc := json.NewEncoder(w)
+		for _, b := range broken {
+			if err := enc.Encode(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, b := range broken {
+		target := b.URL
+		if b.Fragment != "" {
+			target += "#" + b.Fragment
+		}
+		if _, err := fmt.Fprintf(w, "❌ %s: %s\n", target, b.Reason); err != nil {
+			return err
+		}
+		for _, ref := range b.Refs {
+			text := ""
+			if ref.Text != "" {
+				text = fmt.Sprintf(" (%q)", ref.Text)
+			}
+			if _, err := fmt.Fprintf(w, "    linked from %s%s\n", ref.Page, text); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLinkCheck(t *testing.T) {
+	f := newFakeFetcher(map[string][]fakeResponse{
+		site + "/": fakeHTML(`
+			<a href="/docs#install">Install</a>
+			<a href="/docs#nope">Missing <b>section</b></a>
+			<a href="/gone">Old page</a>
+			<a href="https://ext.test/ok">Fine</a>
+			<a href="https://ext.test/nohead">No HEAD</a>
+			<a href="https://ext.test/dead"><img alt="Dead"></a>
+			<a href="#top">Top</a>`),
+		site + "/docs":            fakeHTML(`<h2 id="install">Install</h2> <a href="/deep">Deeper</a> <a href="/gone" title="Gone again"></a>`),
+		site + "/deep":            fakeHTML(`<a href="/deeper">never followed</a>`),
+		"https://ext.test/ok":     {{}},
+		"https://ext.test/nohead": {{NoHead: true}},
+		"https://ext.test/dead":   {{Err: errors.New("connection refused")}},
+	})
+
+	cfg := Config{MaxDepth: 1, CheckLinks: true, IgnoreRobots: true}
+	links := NewLinkChecker(cfg)
+	sum := newTestCrawler(cfg, f).Run(context.Background(), links.Add)
+
+	got := links.Broken()
+	want := []BrokenLink{
+		{URL: "https://ext.test/dead", Reason: "connection refused", Refs: []LinkRef{{Page: site + "/", Text: "Dead"}}},
+		{URL: site + "/docs", Fragment: "nope", Reason: "no element with id nope", Refs: []LinkRef{{Page: site + "/", Text: "Missing section"}}},
+		{URL: site + "/gone", Reason: "404 Not Found", Refs: []LinkRef{{Page: site + "/", Text: "Old page"}, {Page: site + "/docs", Text: "Gone again"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+
+	// /deep is one hop past MaxDepth: checked, but its links aren't.
+	if f.Calls(site+"/deep") != 1 || f.Calls(site+"/deeper") != 0 {
+		t.Errorf("/deep fetched %d times, /deeper %d", f.Calls(site+"/deep"), f.Calls(site+"/deeper"))
+	}
+	// One HEAD, then a GET after the 405.
+	if n := f.Calls("https://ext.test/nohead"); n != 2 {
+		t.Errorf("ext.test/nohead fetched %d times, want 2", n)
+	}
+	if n := f.Calls("https://ext.test/ok"); n != 1 {
+		t.Errorf("ext.test/ok fetched %d times, want 1", n)
+	}
+	if sum.Failed != 1 {
+		t.Errorf("got %d failures, want 1", sum.Failed)
+	}
+
+	var out bytes.Buffer
+	if err := WriteBrokenLinks(&out, "text", got[2:]); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `linked from https://site.test/docs ("Gone again")`) {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+}
@@ -0,0 +1,174 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the fetch latency
+// histogram.
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram is a cumulative Prometheus-style histogram.
+type histogram struct {
+	bounds []float64
+	counts []uint64 // counts[i] observations <= bounds[i]
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range h.bounds {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// quantile estimates the q-th quantile (0 to 1) of what was observed,
+// interpolating linearly inside the bucket it falls in. Values above
+// the last bound are reported as that bound.
+func (h *histogram) quantile(q float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+	rank := max(math.Ceil(q*float64(h.count)), 1)
+	lower, below := 0.0, uint64(0)
+	for i, b := range h.bounds {
+		if float64(h.counts[i]) >= rank {
+			return lower + (b-lower)*(rank-float64(below))/float64(h.counts[i]-below)
+		}
+		lower, below = b, h.counts[i]
+	}
+	return lower
+}
+
+// exponentialBuckets returns n bounds starting at start, each factor
+// times the one before.
+func exponentialBuckets(start, factor float64, n int) []float64 {
+	bounds := make([]float64, n)
+	for i := range bounds {
+		bounds[i] = start
+		start *= factor
+	}
+	return bounds
+}
+
+// metrics exposes live crawl counters in the Prometheus text format.
+// It is safe for concurrent use.
+type metrics struct {
+	mu sync.Mutex
+
+	inflight   map[int]int    // requests in flight per worker id
+	queueDepth int            // URLs waiting to be handed to a worker
+	results    map[string]int // results by status code, "error" or "skipped"
+	latency    *histogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		inflight: make(map[int]int),
+		results:  make(map[string]int),
+		latency:  newHistogram(latencyBuckets),
+	}
+}
+
+func (m *metrics) addInflight(worker, delta int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inflight[worker] += delta
+}
+
+// removeWorker drops a worker that has exited.
+func (m *metrics) removeWorker(worker int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.inflight, worker)
+}
+
+func (m *metrics) setQueueDepth(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.queueDepth = n
+}
+
+// observe records a finished result.
+func (m *metrics) observe(r Result) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case r.Skipped != "":
+		m.results["skipped"]++
+	case r.Page != nil:
+		m.results[strconv.Itoa(r.Page.StatusCode)]++
+		m.latency.observe(r.Page.Elapsed.Seconds())
+	default:
+		m.results["error"]++
+	}
+}
+
+// ServeHTTP serves the metrics page.
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.writeTo(w)
+}
+
+func (m *metrics) writeTo(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP crawler_inflight_requests Requests currently in flight, per worker.")
+	fmt.Fprintln(w, "# TYPE crawler_inflight_requests gauge")
+	workers := make([]int, 0, len(m.inflight))
+	for id := range m.inflight {
+		workers = append(workers, id)
+	}
+	sort.Ints(workers)
+	for _, id := range workers {
+		fmt.Fprintf(w, "crawler_inflight_requests{worker=\"%d\"} %d\n", id, m.inflight[id])
+	}
+
+	fmt.Fprintln(w, "# HELP crawler_workers Running workers.")
+	fmt.Fprintln(w, "# TYPE crawler_workers gauge")
+	fmt.Fprintf(w, "crawler_workers %d\n", len(m.inflight))
+
+	fmt.Fprintln(w, "# HELP crawler_queue_depth URLs waiting to be fetched.")
+	fmt.Fprintln(w, "# TYPE crawler_queue_depth gauge")
+	fmt.Fprintf(w, "crawler_queue_depth %d\n", m.queueDepth)
+
+	fmt.Fprintln(w, "# HELP crawler_results_total Finished URLs by HTTP status, \"error\" or \"skipped\".")
+	fmt.Fprintln(w, "# TYPE crawler_results_total counter")
+	statuses := make([]string, 0, len(m.results))
+	for s := range m.results {
+		statuses = append(statuses, s)
+	}
+	sort.Strings(statuses)
+	for _, s := range statuses {
+		fmt.Fprintf(w, "crawler_results_total{status=%q} %d\n", s, m.results[s])
+	}
+
+	h := m.latency
+	fmt.Fprintln(w, "# HELP crawler_fetch_duration_seconds Time to fetch a page, including the body.")
+	fmt.Fprintln(w, "# TYPE crawler_fetch_duration_seconds histogram")
+	for i, b := range h.bounds {
+		fmt.Fprintf(w, "crawler_fetch_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(b, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(w, "crawler_fetch_duration_seconds_bucket{le=\"+Inf\"} %d\n", h.count)
+	fmt.Fprintf(w, "crawler_fetch_duration_seconds_sum %s\n", strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "crawler_fetch_duration_seconds_count %d\n", h.count)
+}
@@ -0,0 +1,51 @@
+package crawler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	m := newMetrics()
+	m.addInflight(1, 1)
+	m.addInflight(2, 0)
+	m.setQueueDepth(7)
+	m.observe(Result{Page: &Page{StatusCode: 200, Elapsed: 80 * time.Millisecond}})
+	m.observe(Result{Page: &Page{StatusCode: 200, Elapsed: 3 * time.Second}})
+	m.observe(Result{Skipped: "disallowed"})
+
+	ts := httptest.NewServer(m)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	for _, want := range []string{
+		`crawler_inflight_requests{worker="1"} 1`,
+		`crawler_inflight_requests{worker="2"} 0`,
+		`crawler_queue_depth 7`,
+		`crawler_results_total{status="200"} 2`,
+		`crawler_results_total{status="skipped"} 1`,
+		`crawler_fetch_duration_seconds_bucket{le="0.05"} 0`,
+		`crawler_fetch_duration_seconds_bucket{le="0.1"} 1`,
+		`crawler_fetch_duration_seconds_bucket{le="5"} 2`,
+		`crawler_fetch_duration_seconds_bucket{le="+Inf"} 2`,
+		`crawler_fetch_duration_seconds_count 2`,
+		`# TYPE crawler_fetch_duration_seconds histogram`,
+	} {
+		if !strings.Contains(string(body), want+"\n") {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package crawler
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// trackingParams are query parameters that change the URL but not the page.
+var trackingParams = map[string]bool{
+	"gclid":   true,
+	"fbclid":  true,
+	"msclkid": true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_ga":     true,
+}
+
+func isTrackingParam(key string) bool {
+	return strings.HasPrefix(strings.ToLower(key), "utm_") || trackingParams[strings.ToLower(key)]
+}
+
+// normalizeURL rewrites raw into a canonical form so that equivalent URLs
+// compare equal: scheme and host are lower-cased, default ports and
+// fragments dropped, and query parameters sorted. With stripTracking,
+// utm_* and similar click-tracking parameters are removed as well.
+func normalizeURL(raw string, stripTracking bool) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("not an absolute URL: %q", raw)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key, values := range query {
+			if stripTracking && isTrackingParam(key) {
+				delete(query, key)
+				continue
+			}
+			sort.Strings(values)
+		}
+		// Encode sorts by key.
+		u.RawQuery = query.Encode()
+	}
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+// visitedSet remembers every normalized URL handed to the workers.
+// It is safe for concurrent use.
+type visitedSet struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+func newVisitedSet() *visitedSet {
+	return &visitedSet{seen: make(map[string]struct{})}
+}
+
+// Add records u and reports whether it was new.
+func (v *visitedSet) Add(u string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, ok := v.seen[u]; ok {
+		return false
+	}
+	v.seen[u] = struct{}{}
+	return true
+}
+
+// List returns every URL recorded so far, sorted.
+func (v *visitedSet) List() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	list := make([]string, 0, len(v.seen))
+	for u := range v.seen {
+		list = append(list, u)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Len returns the number of URLs recorded so far.
+func (v *visitedSet) Len() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return len(v.seen)
+}
+
+// urlKey is the key equivalent URLs share: the normalized form of raw,
+// or raw itself if it can't be normalized.
+func urlKey(raw string, stripTracking bool) string {
+	if u, err := normalizeURL(raw, stripTracking); err == nil {
+		return u
+	}
+	return raw
+}
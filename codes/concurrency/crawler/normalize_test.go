@@ -0,0 +1,62 @@
+package crawler
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name          string
+		in            string
+		stripTracking bool
+		want          string
+	}{
+		{"lower-cases scheme and host", "HTTPS://Example.COM/Path", false, "https://example.com/Path"},
+		{"adds root path", "https://example.com", false, "https://example.com/"},
+		{"drops default http port", "http://example.com:80/a", false, "http://example.com/a"},
+		{"drops default https port", "https://example.com:443/a", false, "https://example.com/a"},
+		{"keeps other ports", "http://example.com:8080/a", false, "http://example.com:8080/a"},
+		{"keeps https port 80", "https://example.com:80/a", false, "https://example.com:80/a"},
+		{"removes fragment", "https://example.com/a#section", false, "https://example.com/a"},
+		{"sorts query params", "https://example.com/?b=2&a=1&c=3", false, "https://example.com/?a=1&b=2&c=3"},
+		{"sorts repeated values", "https://example.com/?a=2&a=1", false, "https://example.com/?a=1&a=2"},
+		{"drops empty query", "https://example.com/a?", false, "https://example.com/a"},
+		{"keeps tracking params by default", "https://example.com/?utm_source=x&id=1", false, "https://example.com/?id=1&utm_source=x"},
+		{"strips utm params", "https://example.com/?utm_source=x&UTM_Medium=y&id=1", true, "https://example.com/?id=1"},
+		{"strips click ids", "https://example.com/?gclid=abc&fbclid=def", true, "https://example.com/"},
+		{"ipv6 host", "http://[::1]:80/a", false, "http://[::1]/a"},
+		{"ipv6 host with port", "http://[::1]:8080/a", false, "http://[::1]:8080/a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeURL(tt.in, tt.stripTracking)
+			if err != nil {
+				t.Fatalf("normalizeURL(%q) error: %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeURLErrors(t *testing.T) {
+	for _, in := range []string{"", "/relative/path", "example.com", "http://%zz"} {
+		if got, err := normalizeURL(in, false); err == nil {
+			t.Errorf("normalizeURL(%q) = %q, want error", in, got)
+		}
+	}
+}
+
+func TestVisitedSet(t *testing.T) {
+	v := newVisitedSet()
+
+	if !v.Add("https://example.com/") {
+		t.Errorf("first Add should report a new URL")
+	}
+	if v.Add("https://example.com/") {
+		t.Errorf("second Add should report a duplicate")
+	}
+	if got := v.Len(); got != 1 {
+		t.Errorf("got %d want %d", got, 1)
+	}
+}
@@ -0,0 +1,235 @@
+package crawler
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenBucket allows rate events per second with bursts of up to burst.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	burst = max(burst, 1)
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+}
+
+// wait returns how long until a token is available, without taking it.
+func (b *tokenBucket) wait(now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) take(now time.Time) {
+	b.refill(now)
+	b.tokens--
+}
+
+// hostState is the politeness bookkeeping for one host.
+type hostState struct {
+	bucket *tokenBucket
+	active int // requests currently in flight
+}
+
+// scheduler decides when a request to a host may start. It combines a
+// global requests-per-second cap with a token bucket and a connection
+// limit per host, so a strict host only holds back its own URLs.
+type scheduler struct {
+	mu sync.Mutex
+
+	global     *tokenBucket // nil means no global cap
+	hostRate   float64      // 0 means no per-host rate
+	hostBurst  int
+	maxPerHost int // 0 means no limit
+	hosts      map[string]*hostState
+
+	now func() time.Time
+}
+
+func newScheduler(cfg Config) *scheduler {
+	s := &scheduler{
+		hostRate:   cfg.HostRequestsPerSecond,
+		hostBurst:  cfg.HostBurst,
+		maxPerHost: cfg.MaxConnsPerHost,
+		hosts:      make(map[string]*hostState),
+		now:        time.Now,
+	}
+	if cfg.RequestsPerSecond > 0 {
+		s.global = newTokenBucket(cfg.RequestsPerSecond, max(1, int(cfg.RequestsPerSecond)))
+	}
+	return s
+}
+
+func (s *scheduler) host(host string) *hostState {
+	h, ok := s.hosts[host]
+	if !ok {
+		h = &hostState{}
+		if s.hostRate > 0 {
+			h.bucket = newTokenBucket(s.hostRate, s.hostBurst)
+		}
+		s.hosts[host] = h
+	}
+	return h
+}
+
+// ready reports whether a request to host could start now. If not, wait
+// is how long until a token frees up, or 0 if the host is at its
+// connection limit and has to wait for a release instead.
+func (s *scheduler) ready(host string) (ok bool, wait time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.readyLocked(host)
+}
+
+func (s *scheduler) readyLocked(host string) (ok bool, wait time.Duration) {
+	h := s.host(host)
+	if s.maxPerHost > 0 && h.active >= s.maxPerHost {
+		return false, 0
+	}
+
+	now := s.now()
+	if h.bucket != nil {
+		wait = h.bucket.wait(now)
+	}
+	if s.global != nil {
+		wait = max(wait, s.global.wait(now))
+	}
+	return wait == 0, wait
+}
+
+// acquire records the start of a request to host. Callers check ready
+// first; acquire itself never blocks. If a request made through wait
+// or retry took the token in between, the bucket goes into debt and
+// the host's next request waits longer, so the rate still holds.
+func (s *scheduler) acquire(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.acquireLocked(host)
+}
+
+func (s *scheduler) acquireLocked(host string) {
+	now := s.now()
+	h := s.host(host)
+	h.active++
+	if h.bucket != nil {
+		h.bucket.take(now)
+	}
+	if s.global != nil {
+		s.global.take(now)
+	}
+}
+
+// connPoll is how often wait checks a host that is at its connection
+// limit, since nothing signals the release it is waiting for.
+const connPoll = 10 * time.Millisecond
+
+// wait blocks until a request to host may start and acquires it, for
+// requests made off the coordinator's loop, like sitemap fetches.
+// Callers release host when the request is done.
+func (s *scheduler) wait(ctx context.Context, host string) error {
+	for {
+		s.mu.Lock()
+		ok, wait := s.readyLocked(host)
+		if ok {
+			s.acquireLocked(host)
+		}
+		s.mu.Unlock()
+		if ok {
+			return nil
+		}
+		if wait == 0 {
+			wait = connPoll
+		}
+		if err := sleepCtx(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// retry takes a token for another try at a request to host that is
+// already in flight, so it keeps its connection slot. If no token is
+// free it takes nothing and returns how long to wait before asking
+// again.
+func (s *scheduler) retry(host string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	h := s.host(host)
+	var wait time.Duration
+	if h.bucket != nil {
+		wait = h.bucket.wait(now)
+	}
+	if s.global != nil {
+		wait = max(wait, s.global.wait(now))
+	}
+	if wait > 0 {
+		return wait
+	}
+	if h.bucket != nil {
+		h.bucket.take(now)
+	}
+	if s.global != nil {
+		s.global.take(now)
+	}
+	return 0
+}
+
+// release records the end of a request to host.
+func (s *scheduler) release(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if h, ok := s.hosts[host]; ok && h.active > 0 {
+		h.active--
+	}
+}
+
+// setCrawlDelay slows host down to at most one request per delay, as
+// asked for by its robots.txt. It never speeds a host up.
+func (s *scheduler) setCrawlDelay(host string, delay time.Duration) {
+	if delay <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rate := float64(time.Second) / float64(delay)
+	h := s.host(host)
+	if h.bucket == nil || rate < h.bucket.rate {
+		b := newTokenBucket(rate, 1)
+		if h.bucket != nil {
+			b.tokens, b.last = min(h.bucket.tokens, 1), h.bucket.last
+		}
+		h.bucket = b
+	}
+}
+
+// hostOf returns the lower-cased host[:port] a URL will connect to.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
@@ -0,0 +1,50 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerLimits(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := newScheduler(Config{HostRequestsPerSecond: 2, HostBurst: 1, MaxConnsPerHost: 1})
+	s.now = func() time.Time { return now }
+
+	if ok, _ := s.ready("a.test"); !ok {
+		t.Fatalf("first request to a host should be ready")
+	}
+	s.acquire("a.test")
+
+	// At the connection limit: no token wait, just a release.
+	if ok, wait := s.ready("a.test"); ok || wait != 0 {
+		t.Errorf("got ok=%v wait=%v, want blocked on a connection slot", ok, wait)
+	}
+	// Other hosts are unaffected.
+	if ok, _ := s.ready("b.test"); !ok {
+		t.Errorf("b.test should not wait on a.test")
+	}
+
+	s.release("a.test")
+	if ok, wait := s.ready("a.test"); ok || wait != 500*time.Millisecond {
+		t.Errorf("got ok=%v wait=%v, want a 500ms token wait", ok, wait)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := s.ready("a.test"); !ok {
+		t.Errorf("a.test should be ready once its token refills")
+	}
+}
+
+func TestSchedulerCrawlDelay(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := newScheduler(Config{HostRequestsPerSecond: 10})
+	s.now = func() time.Time { return now }
+
+	s.setCrawlDelay("a.test", 2*time.Second)
+	s.acquire("a.test")
+	s.release("a.test")
+
+	if _, wait := s.ready("a.test"); wait != 2*time.Second {
+		t.Errorf("got wait %v want %v", wait, 2*time.Second)
+	}
+}
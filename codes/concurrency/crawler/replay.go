@@ -0,0 +1,29 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+)
+
+// ReplayFetcher serves pages from a cassette instead of the network. It
+// is the HTTP fetcher over a ReplayTransport, so pages come out as a
+// live fetch would make them: redirects followed through their recorded
+// hops, repeated URLs answered in recorded order, bodies cut to the
+// size cap.
+type ReplayFetcher struct {
+	f *httpFetcher
+}
+
+// NewReplayFetcher loads the cassette at path. Bodies are cut to
+// maxBody bytes like a live fetch would; 0 means no cap.
+func NewReplayFetcher(path string, maxBody int64) (*ReplayFetcher, error) {
+	t, err := NewReplayTransport(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ReplayFetcher{f: newHTTPFetcher(&http.Client{Transport: t}, "", maxBody)}, nil
+}
+
+func (f *ReplayFetcher) Fetch(ctx context.Context, url string) (*Page, error) {
+	return f.f.Fetch(ctx, url)
+}
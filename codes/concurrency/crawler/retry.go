@@ -0,0 +1,232 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// statusError is a response that should be treated as a failure.
+type statusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *statusError) Error() string {
+	return "server responded " + e.Status
+}
+
+// retryPolicy decides whether and when a failed fetch is tried again.
+type retryPolicy struct {
+	maxAttempts int           // total tries, including the first
+	baseDelay   time.Duration // backoff cap for the first retry
+	maxDelay    time.Duration // backoff never exceeds this
+}
+
+func newRetryPolicy(cfg Config) retryPolicy {
+	return retryPolicy{
+		maxAttempts: max(cfg.MaxAttempts, 1),
+		baseDelay:   cfg.RetryBaseDelay,
+		maxDelay:    cfg.RetryMaxDelay,
+	}
+}
+
+// backoff returns the delay before retry number attempt (starting at 1),
+// using "full jitter": a random duration between zero and an
+// exponentially growing cap, so retrying workers don't move in lockstep.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.baseDelay
+	for i := 1; i < attempt && ceiling > 0; i++ {
+		if p.maxDelay > 0 && ceiling >= p.maxDelay || ceiling > math.MaxInt64/2 {
+			break
+		}
+		ceiling *= 2
+	}
+	if p.maxDelay > 0 {
+		ceiling = min(ceiling, p.maxDelay)
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// retryable reports whether a fetch that ended with page and err is
+// worth trying again: transient network errors, 5xx and 429 are; a
+// cancelled context is not.
+func retryable(ctx context.Context, page *Page, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return transient(err)
+	}
+	return page.StatusCode == http.StatusTooManyRequests || page.StatusCode >= 500
+}
+
+// transient reports whether err is a network failure or timeout that
+// may not happen again: a refused, reset or dropped connection, a DNS
+// lookup that timed out, a request that ran out of time. Certificate
+// and TLS errors, bad URLs and unsupported schemes fail the same way
+// every time.
+func transient(err error) bool {
+	var (
+		certErr      *tls.CertificateVerificationError
+		alertErr     tls.AlertError
+		recordErr    tls.RecordHeaderError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+		dnsErr       *net.DNSError
+		opErr        *net.OpError
+	)
+	switch {
+	case errors.Is(err, context.Canceled):
+		return false
+	case errors.As(err, &certErr), errors.As(err, &alertErr), errors.As(err, &recordErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return false
+	case limitOf(err) != "":
+		return true
+	case errors.As(err, &dnsErr):
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNABORTED), errors.Is(err, syscall.EPIPE):
+		return true
+	case errors.As(err, &opErr):
+		return true
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header, given either in seconds or as
+// an HTTP date.
+func retryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// sleepCtx waits for d or until ctx is done, whichever comes first.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// fetchWithRetry fetches url, retrying transient failures according to
+// c.retry. It fills in r.Page, r.Attempts, r.AttemptErrors and r.Err.
+// Retries wait for the host's rate limits like any other request.
+func (c *Crawler) fetchWithRetry(ctx context.Context, url string, r *Result) {
+	c.retryFetch(ctx, c.fetcher, url, r)
+}
+
+// retryFetch is fetchWithRetry with f in place of c.fetcher.
+func (c *Crawler) retryFetch(ctx context.Context, f Fetcher, url string, r *Result) {
+	host := hostOf(url)
+	for attempt := 1; ; attempt++ {
+		r.Attempts++
+		page, err := f.Fetch(ctx, url)
+		r.Page, r.Err = page, err
+		if err == nil && (page.StatusCode == http.StatusTooManyRequests || page.StatusCode >= 500) {
+			r.Err = &statusError{StatusCode: page.StatusCode, Status: page.Status}
+		}
+		if r.Err == nil {
+			return
+		}
+		r.AttemptErrors = append(r.AttemptErrors, r.Err)
+
+		if attempt >= c.retry.maxAttempts || !retryable(ctx, page, err) {
+			return
+		}
+
+		delay := c.retry.backoff(attempt)
+		if page != nil {
+			if after, ok := retryAfter(page.Header, time.Now()); ok {
+				if c.retry.maxDelay > 0 && after > c.retry.maxDelay {
+					r.Err = fmt.Errorf("%w (Retry-After %v exceeds max delay)", r.Err, after)
+					return
+				}
+				delay = max(delay, after)
+			}
+		}
+		if err := sleepCtx(ctx, delay); err != nil {
+			return
+		}
+		for {
+			wait := c.sched.retry(host)
+			if wait == 0 {
+				break
+			}
+			if err := sleepCtx(ctx, wait); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// retryingFetcher fetches through fetchWithRetry, so requests made on
+// the side, like robots.txt, ride out transient failures as pages do.
+// A response that is still an error after the last try is returned as
+// a page for the caller to judge.
+type retryingFetcher struct{ c *Crawler }
+
+func (f retryingFetcher) Fetch(ctx context.Context, url string) (*Page, error) {
+	var r Result
+	f.c.fetchWithRetry(ctx, url, &r)
+	if r.Page != nil {
+		return r.Page, nil
+	}
+	return nil, r.Err
+}
+
+// checkLink fetches a link that is checked rather than crawled. With
+// head set it tries a single HEAD request first and falls back to GET
+// if that fails, since plenty of servers refuse or mishandle HEAD.
+func (c *Crawler) checkLink(ctx context.Context, url string, head bool, r *Result) {
+	if hf, ok := c.fetcher.(headFetcher); ok && head {
+		r.Attempts++
+		page, err := hf.Head(ctx, url)
+		if err == nil && page.StatusCode < 400 {
+			r.Page = page
+			return
+		}
+		if err == nil {
+			err = &statusError{StatusCode: page.StatusCode, Status: page.Status}
+		}
+		r.AttemptErrors = append(r.AttemptErrors, fmt.Errorf("HEAD: %w", err))
+		if ctx.Err() != nil {
+			r.Err = err
+			return
+		}
+	}
+	c.fetchWithRetry(ctx, url, r)
+}
@@ -0,0 +1,172 @@
+package crawler
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBackoffBounds(t *testing.T) {
+	p := retryPolicy{maxAttempts: 5, baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+
+	for attempt, ceiling := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		5: time.Second,
+		9: time.Second,
+	} {
+		for range 100 {
+			if d := p.backoff(attempt); d < 0 || d > ceiling {
+				t.Fatalf("backoff(%d) = %v, want within [0, %v]", attempt, d, ceiling)
+			}
+		}
+	}
+}
+
+func TestBackoffUncapped(t *testing.T) {
+	p := retryPolicy{maxAttempts: 5, baseDelay: 100 * time.Millisecond}
+
+	// With no max delay the cap keeps doubling; sample until backoff
+	// goes past what the first retry could wait.
+	for range 1000 {
+		if p.backoff(4) > 400*time.Millisecond {
+			return
+		}
+	}
+	t.Error("backoff(4) never exceeded 400ms without a max delay")
+}
+
+func TestTransient(t *testing.T) {
+	urlErr := func(err error) error { return &url.Error{Op: "Get", URL: "https://site.test/", Err: err} }
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{urlErr(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}), true},
+		{urlErr(&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}), true},
+		{urlErr(io.ErrUnexpectedEOF), true},
+		{urlErr(context.DeadlineExceeded), true},
+		{fmt.Errorf("get: %w", &limitError{Limit: LimitConnect, After: time.Second}), true},
+		{urlErr(&net.DNSError{Err: "timeout", Name: "site.test", IsTimeout: true}), true},
+		{urlErr(&net.DNSError{Err: "no such host", Name: "site.test", IsNotFound: true}), false},
+		{urlErr(x509.UnknownAuthorityError{}), false},
+		{urlErr(x509.HostnameError{Certificate: &x509.Certificate{}, Host: "site.test"}), false},
+		{urlErr(errors.New(`unsupported protocol scheme "ftp"`)), false},
+		{urlErr(context.Canceled), false},
+	}
+	for _, tt := range tests {
+		if got := transient(tt.err); got != tt.want {
+			t.Errorf("transient(%v) = %v want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"Mon, 01 Jan 2024 12:00:10 GMT", 10 * time.Second, true},
+		{"Mon, 01 Jan 2024 11:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.value != "" {
+			h.Set("Retry-After", tt.value)
+		}
+		got, ok := retryAfter(h, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %v, %v want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFetchWithRetry(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer ts.Close()
+
+	c := New(Config{MaxAttempts: 3, RetryBaseDelay: time.Millisecond, Client: ts.Client()})
+	var r Result
+	c.fetchWithRetry(context.Background(), ts.URL, &r)
+
+	if r.Err != nil {
+		t.Fatalf("unexpected error: %v", r.Err)
+	}
+	if r.Attempts != 3 || len(r.AttemptErrors) != 2 {
+		t.Errorf("got %d attempts and %d errors, want 3 and 2", r.Attempts, len(r.AttemptErrors))
+	}
+}
+
+func TestFetchWithRetryGivesUp(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	c := New(Config{MaxAttempts: 2, RetryBaseDelay: time.Millisecond, Client: ts.Client()})
+	var r Result
+	c.fetchWithRetry(context.Background(), ts.URL, &r)
+
+	se, ok := r.Err.(*statusError)
+	if !ok || se.StatusCode != http.StatusBadGateway {
+		t.Fatalf("got error %v, want a 502 statusError", r.Err)
+	}
+	if r.Attempts != 2 || r.Page == nil {
+		t.Errorf("got %d attempts, page %v; want 2 attempts and the last page", r.Attempts, r.Page)
+	}
+}
+
+func TestFetchWithRetryWaitsForHostRate(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	c := New(Config{MaxAttempts: 3, HostRequestsPerSecond: 10, Client: ts.Client()})
+	host := hostOf(ts.URL)
+	c.sched.acquire(host) // as the coordinator does for the first try
+
+	start := time.Now()
+	var r Result
+	c.fetchWithRetry(context.Background(), ts.URL, &r)
+	if r.Err != nil || r.Attempts != 3 {
+		t.Fatalf("got err=%v after %d attempts", r.Err, r.Attempts)
+	}
+	// Three requests at 10 per second with a burst of one take at
+	// least 200ms, however short the backoff.
+	if d := time.Since(start); d < 180*time.Millisecond {
+		t.Errorf("retries took %v, faster than the host rate", d)
+	}
+}
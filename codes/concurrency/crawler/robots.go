@@ -0,0 +1,360 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// robotsRule is a single Allow or Disallow line.
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// robotsGroup is the set of rules that applies to one or more user agents.
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// robotsTxt is a parsed robots.txt file.
+type robotsTxt struct {
+	groups   []*robotsGroup
+	sitemaps []string
+}
+
+// Allow-all and disallow-all stand-ins for missing or broken files.
+var (
+	robotsAllowAll    = &robotsTxt{}
+	robotsDisallowAll = &robotsTxt{groups: []*robotsGroup{{
+		agents: []string{"*"},
+		rules:  []robotsRule{{allow: false, pattern: "/"}},
+	}}}
+)
+
+// parseRobots reads a robots.txt file. Unknown lines are ignored, as the
+// format asks for.
+func parseRobots(r io.Reader) *robotsTxt {
+	txt := &robotsTxt{}
+	var group *robotsGroup
+	inAgents := false // true while reading consecutive User-agent lines
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				group = &robotsGroup{}
+				txt.groups = append(txt.groups, group)
+				inAgents = true
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+
+		case "allow", "disallow":
+			inAgents = false
+			if group == nil || value == "" {
+				continue
+			}
+			group.rules = append(group.rules, robotsRule{allow: key == "allow", pattern: value})
+
+		case "crawl-delay":
+			inAgents = false
+			if group == nil {
+				continue
+			}
+			if secs, err := strconv.ParseFloat(value, 64); err == nil && secs >= 0 {
+				group.crawlDelay = time.Duration(secs * float64(time.Second))
+			}
+
+		case "sitemap":
+			// Sitemap lines belong to the whole file, not a group.
+			if value != "" {
+				txt.sitemaps = append(txt.sitemaps, value)
+			}
+		}
+	}
+	return txt
+}
+
+// agentToken is the product name robots.txt groups match against,
+// e.g. "gocrawler" for "gocrawler/1.0 (+https://example.com)".
+func agentToken(userAgent string) string {
+	token, _, _ := strings.Cut(strings.TrimSpace(userAgent), "/")
+	token, _, _ = strings.Cut(token, " ")
+	return strings.ToLower(token)
+}
+
+// group returns the rules for userAgent: groups naming the agent win
+// over the "*" group. Groups for the same agent are merged.
+func (r *robotsTxt) group(userAgent string) *robotsGroup {
+	token := agentToken(userAgent)
+	var specific, wildcard []*robotsGroup
+	for _, g := range r.groups {
+		for _, a := range g.agents {
+			if a == "*" {
+				wildcard = append(wildcard, g)
+				break
+			}
+			if token != "" && a == token {
+				specific = append(specific, g)
+				break
+			}
+		}
+	}
+
+	matched := specific
+	if len(matched) == 0 {
+		matched = wildcard
+	}
+	if len(matched) == 1 {
+		return matched[0]
+	}
+	merged := &robotsGroup{}
+	for _, g := range matched {
+		merged.rules = append(merged.rules, g.rules...)
+		merged.crawlDelay = max(merged.crawlDelay, g.crawlDelay)
+	}
+	return merged
+}
+
+// allowed reports whether path (including any query) may be fetched,
+// and which rule decided it. The longest matching pattern wins; on a
+// tie Allow beats Disallow.
+func (g *robotsGroup) allowed(path string) (bool, string) {
+	best := -1
+	allow := true
+	rule := ""
+	for _, r := range g.rules {
+		if !matchRobotsPattern(r.pattern, path) {
+			continue
+		}
+		n := len(r.pattern)
+		if n > best || (n == best && r.allow && !allow) {
+			best = n
+			allow = r.allow
+			rule = r.pattern
+		}
+	}
+	return allow, rule
+}
+
+// matchRobotsPattern matches path against a robots.txt pattern, where
+// '*' matches any run of characters and a trailing '$' anchors the end.
+func matchRobotsPattern(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i, part := range parts[1:] {
+		last := i == len(parts)-2
+		if last && anchored {
+			return len(path)-pos >= len(part) && strings.HasSuffix(path, part)
+		}
+		j := strings.Index(path[pos:], part)
+		if j < 0 {
+			return false
+		}
+		pos += j + len(part)
+	}
+	return !anchored || pos == len(path)
+}
+
+// unreachableTTL is how long a host whose robots.txt couldn't be
+// fetched stays off limits before it is tried again.
+const unreachableTTL = time.Minute
+
+// robotsCache fetches robots.txt once per scheme and host and shares the
+// result between workers.
+type robotsCache struct {
+	fetcher   Fetcher
+	userAgent string
+	retryIn   time.Duration // unreachableTTL, shorter in tests
+
+	mu      sync.Mutex
+	entries map[string]*robotsEntry
+}
+
+type robotsEntry struct {
+	ready chan struct{} // closed once txt and err are set
+	txt   *robotsTxt
+	err   error // why robots.txt is unavailable; txt then disallows all
+
+	expires time.Time // when to fetch again; zero for never. Guarded by mu.
+}
+
+func newRobotsCache(fetcher Fetcher, userAgent string) *robotsCache {
+	return &robotsCache{
+		fetcher:   fetcher,
+		userAgent: userAgent,
+		retryIn:   unreachableTTL,
+		entries:   make(map[string]*robotsEntry),
+	}
+}
+
+// robotsKey identifies the robots.txt that covers u.
+func robotsKey(u *url.URL) string {
+	return u.Scheme + "://" + strings.ToLower(u.Host)
+}
+
+// get returns the robots.txt entry for u's host, fetching it on first
+// use and again once an unreachable one expires. Concurrent callers for
+// the same host wait for a single fetch. The only errors are ctx's.
+func (c *robotsCache) get(ctx context.Context, u *url.URL) (*robotsEntry, error) {
+	key := robotsKey(u)
+	for {
+		c.mu.Lock()
+		e, ok := c.entries[key]
+		if ok && !e.expires.IsZero() && time.Now().After(e.expires) {
+			ok = false
+		}
+		if !ok {
+			e = &robotsEntry{ready: make(chan struct{})}
+			c.entries[key] = e
+		}
+		c.mu.Unlock()
+
+		if !ok {
+			c.load(ctx, key, e)
+		}
+
+		select {
+		case <-e.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if e.txt != nil {
+			return e, nil
+		}
+		// Whoever fetched it was cancelled; try again unless we are too.
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// load fetches robots.txt into e. A fetch cut short by ctx leaves no
+// entry behind, so the next caller tries again.
+func (c *robotsCache) load(ctx context.Context, key string, e *robotsEntry) {
+	defer close(e.ready)
+	txt, err := c.fetch(ctx, key+"/robots.txt")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil && ctx.Err() != nil {
+		if c.entries[key] == e {
+			delete(c.entries, key)
+		}
+		return
+	}
+	e.txt, e.err = txt, err
+	if err != nil {
+		e.expires = time.Now().Add(c.retryIn)
+	}
+}
+
+// fetch returns the robots.txt at robotsURL. When the file is
+// unreachable, through a network error or a server error, the rules
+// can't be known, so it returns an error along with rules that
+// disallow everything (RFC 9309, section 2.3.1.4).
+func (c *robotsCache) fetch(ctx context.Context, robotsURL string) (*robotsTxt, error) {
+	page, err := c.fetcher.Fetch(ctx, robotsURL)
+	if err != nil {
+		return robotsDisallowAll, err
+	}
+
+	switch {
+	case page.StatusCode >= 200 && page.StatusCode < 300:
+		// 500 KiB is the limit crawlers are required to read.
+		body := page.Body[:min(len(page.Body), 500<<10)]
+		return parseRobots(bytes.NewReader(body)), nil
+	case page.StatusCode >= 400 && page.StatusCode < 500:
+		// No robots.txt (or no access to it) means no restrictions.
+		return robotsAllowAll, nil
+	default:
+		return robotsDisallowAll, fmt.Errorf("server responded %s", page.Status)
+	}
+}
+
+// Allowed reports whether rawURL may be crawled. When it may not, the
+// returned reason says which rule blocked it.
+func (c *robotsCache) Allowed(ctx context.Context, rawURL string) (bool, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, "", err
+	}
+	if u.Path == "/robots.txt" {
+		return true, "", nil
+	}
+
+	e, err := c.get(ctx, u)
+	if err != nil {
+		return false, "", fmt.Errorf("robots.txt: %w", err)
+	}
+	if e.err != nil {
+		return false, fmt.Sprintf("robots.txt unreachable, host disallowed for now (%v)", e.err), nil
+	}
+	ok, rule := e.txt.group(c.userAgent).allowed(u.RequestURI())
+	if ok {
+		return true, "", nil
+	}
+	return false, fmt.Sprintf("disallowed by robots.txt (Disallow: %s)", rule), nil
+}
+
+// CrawlDelay returns the Crawl-delay for u's host, if robots.txt has
+// already been fetched for it.
+func (c *robotsCache) CrawlDelay(u *url.URL) time.Duration {
+	c.mu.Lock()
+	e, ok := c.entries[robotsKey(u)]
+	c.mu.Unlock()
+	if !ok {
+		return 0
+	}
+
+	select {
+	case <-e.ready:
+		if e.txt == nil || e.err != nil {
+			return 0
+		}
+		return e.txt.group(c.userAgent).crawlDelay
+	default:
+		return 0
+	}
+}
+
+// Sitemaps returns the Sitemap URLs listed in u's robots.txt.
+func (c *robotsCache) Sitemaps(ctx context.Context, u *url.URL) ([]string, error) {
+	e, err := c.get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.txt.sitemaps, nil
+}
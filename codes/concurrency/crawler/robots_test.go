@@ -0,0 +1,221 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testRobots = `
+# comment line
+User-agent: *
+Disallow: /private/
+Allow: /private/public
+Disallow: /*.pdf$
+Crawl-delay: 2
+
+User-agent: gocrawler
+User-agent: otherbot
+Disallow: /no-bots
+Crawl-delay: 0.5
+
+Sitemap: https://example.com/sitemap.xml
+`
+
+func TestRobotsGroups(t *testing.T) {
+	txt := parseRobots(strings.NewReader(testRobots))
+
+	tests := []struct {
+		agent string
+		path  string
+		want  bool
+	}{
+		{"somebot/2.0", "/", true},
+		{"somebot/2.0", "/private/secret", false},
+		{"somebot/2.0", "/private/public/page", true},
+		{"somebot/2.0", "/files/report.pdf", false},
+		{"somebot/2.0", "/files/report.pdf?download=1", true},
+		{"gocrawler/1.0", "/private/secret", true},
+		{"gocrawler/1.0", "/no-bots/here", false},
+		{"OtherBot", "/no-bots", false},
+	}
+
+	for _, tt := range tests {
+		got, _ := txt.group(tt.agent).allowed(tt.path)
+		if got != tt.want {
+			t.Errorf("%s %s: got %v want %v", tt.agent, tt.path, got, tt.want)
+		}
+	}
+
+	if got, want := txt.group("somebot").crawlDelay, 2*time.Second; got != want {
+		t.Errorf("crawl delay: got %v want %v", got, want)
+	}
+	if got, want := txt.group("gocrawler/1.0").crawlDelay, 500*time.Millisecond; got != want {
+		t.Errorf("crawl delay: got %v want %v", got, want)
+	}
+	if len(txt.sitemaps) != 1 || txt.sitemaps[0] != "https://example.com/sitemap.xml" {
+		t.Errorf("got sitemaps %v", txt.sitemaps)
+	}
+}
+
+func TestMatchRobotsPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/", "/anything", true},
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish", false},
+		{"/fish/", "/fish", false},
+		{"/*.php", "/index.php", true},
+		{"/*.php", "/folder/filename.php?params", true},
+		{"/*.php$", "/filename.php", true},
+		{"/*.php$", "/filename.php?params", false},
+		{"/fish*.php", "/fishheads/catfish.php", true},
+		{"/a*b*c", "/axxbyyc", true},
+		{"/a*b*c", "/axxcyyb", false},
+		{"/exact$", "/exact", true},
+		{"/exact$", "/exact/more", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchRobotsPattern(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("match(%q, %q): got %v want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRobotsCache(t *testing.T) {
+	var fetches atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		fetches.Add(1)
+		if got := r.Header.Get("User-Agent"); got != "gocrawler/1.0" {
+			t.Errorf("robots.txt fetched with User-Agent %q", got)
+		}
+		w.Write([]byte(testRobots))
+	}))
+	defer ts.Close()
+
+	cache := newRobotsCache(newHTTPFetcher(ts.Client(), "gocrawler/1.0", 0), "gocrawler/1.0")
+	ctx := context.Background()
+
+	ok, _, err := cache.Allowed(ctx, ts.URL+"/docs")
+	if err != nil || !ok {
+		t.Fatalf("got %v, %v want allowed", ok, err)
+	}
+	ok, reason, err := cache.Allowed(ctx, ts.URL+"/no-bots/page")
+	if err != nil || ok {
+		t.Fatalf("got %v, %v want disallowed", ok, err)
+	}
+	if !strings.Contains(reason, "/no-bots") {
+		t.Errorf("reason %q should name the rule", reason)
+	}
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("robots.txt fetched %d times, want once", got)
+	}
+}
+
+func TestRobotsCacheStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{http.StatusNotFound, true},
+		{http.StatusForbidden, true},
+		{http.StatusServiceUnavailable, false},
+	}
+
+	for _, tt := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+
+		cache := newRobotsCache(newHTTPFetcher(ts.Client(), "gocrawler/1.0", 0), "gocrawler/1.0")
+		ok, _, err := cache.Allowed(context.Background(), ts.URL+"/page")
+		if err != nil {
+			t.Errorf("status %d: unexpected error %v", tt.status, err)
+		}
+		if ok != tt.want {
+			t.Errorf("status %d: got %v want %v", tt.status, ok, tt.want)
+		}
+		ts.Close()
+	}
+}
+
+func TestRobotsRetriedThroughCrawl(t *testing.T) {
+	// The first robots.txt connection is dropped, as a flaky network
+	// would; the retry policy should cover it like any page.
+	var robotsFetches atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" && robotsFetches.Add(1) == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	c := New(Config{Seeds: []string{ts.URL + "/"}, Workers: 1, MaxAttempts: 3, RetryBaseDelay: time.Millisecond, Client: ts.Client()})
+	var got Result
+	c.Run(context.Background(), func(r Result) { got = r })
+
+	if got.Err != nil || got.Skipped != "" {
+		t.Errorf("seed: err=%v skipped=%q", got.Err, got.Skipped)
+	}
+	if n := robotsFetches.Load(); n != 2 {
+		t.Errorf("robots.txt fetched %d times, want 2", n)
+	}
+}
+
+func TestRobotsUnreachable(t *testing.T) {
+	f := newFakeFetcher(map[string][]fakeResponse{
+		site + "/robots.txt": {{Err: errors.New("connection refused")}, {Body: "User-agent: *\nDisallow:\n"}},
+	})
+	cache := newRobotsCache(f, "gocrawler/1.0")
+	cache.retryIn = 20 * time.Millisecond
+	ctx := context.Background()
+
+	// Unreachable: the host is off limits for now, which is a skip and
+	// not an error.
+	ok, reason, err := cache.Allowed(ctx, site+"/a")
+	if err != nil || ok || !strings.Contains(reason, "connection refused") {
+		t.Errorf("got %v %q %v, want disallowed for now", ok, reason, err)
+	}
+	if ok, _, _ := cache.Allowed(ctx, site+"/b"); ok || f.Calls(site+"/robots.txt") != 1 {
+		t.Errorf("got %v after %d fetches; want the failure cached briefly", ok, f.Calls(site+"/robots.txt"))
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if ok, _, err := cache.Allowed(ctx, site+"/c"); !ok || err != nil {
+		t.Errorf("got %v %v after expiry, want robots.txt fetched again", ok, err)
+	}
+}
+
+func TestRobotsCancelledFetchNotCached(t *testing.T) {
+	f := newFakeFetcher(map[string][]fakeResponse{
+		site + "/robots.txt": {{Delay: time.Hour}, {Body: "User-agent: *\nDisallow: /private\n"}},
+	})
+	cache := newRobotsCache(f, "gocrawler/1.0")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := cache.Allowed(ctx, site+"/a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the ctx error", err)
+	}
+
+	ok, _, err := cache.Allowed(context.Background(), site+"/a")
+	if err != nil || !ok {
+		t.Errorf("got %v %v, want robots.txt fetched again", ok, err)
+	}
+}
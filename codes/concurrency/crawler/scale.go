@@ -0,0 +1,112 @@
+package crawler
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// pool tracks the running workers so Run can add and remove them while
+// the crawl goes on. Each worker has its own quit channel; closing it
+// lets that worker finish its current job and exit, without touching
+// the crawl's ctx. Only Run's goroutine uses a pool.
+type pool struct {
+	start  func(id int, quit <-chan struct{})
+	quits  []chan struct{} // one per running worker, oldest first
+	nextID int
+}
+
+func newPool(start func(id int, quit <-chan struct{})) *pool {
+	return &pool{start: start}
+}
+
+func (p *pool) size() int { return len(p.quits) }
+
+// grow starts one more worker.
+func (p *pool) grow() {
+	p.nextID++
+	quit := make(chan struct{})
+	p.quits = append(p.quits, quit)
+	p.start(p.nextID, quit)
+}
+
+// shrink asks the newest worker to exit.
+func (p *pool) shrink() {
+	last := len(p.quits) - 1
+	close(p.quits[last])
+	p.quits = p.quits[:last]
+}
+
+// resize grows or shrinks the pool to n workers.
+func (p *pool) resize(n int) {
+	for p.size() < n {
+		p.grow()
+	}
+	for p.size() > n {
+		p.shrink()
+	}
+}
+
+// aimd sizes the worker pool the way TCP sizes its congestion window:
+// while fetches are fast and work is queued it adds one worker per
+// window of results, and when errors or 429s pass maxErrorRate it
+// halves the pool.
+type aimd struct {
+	min, max     int
+	window       int           // results per decision
+	latency      time.Duration // add workers only while the mean stays below this
+	maxErrorRate float64
+
+	n, overload int
+	total       time.Duration
+}
+
+func newAIMD(cfg Config) *aimd {
+	return &aimd{
+		min:          max(cfg.MinWorkers, 1),
+		max:          max(cfg.MaxWorkers, cfg.MinWorkers, 1),
+		window:       10,
+		latency:      cmp.Or(cfg.ScaleLatency, time.Second),
+		maxErrorRate: 0.1,
+	}
+}
+
+// overloaded reports whether r suggests the pool is pushing too hard.
+func overloaded(r Result) bool {
+	if r.Page != nil && (r.Page.StatusCode == http.StatusTooManyRequests || r.Page.StatusCode == http.StatusServiceUnavailable) {
+		return true
+	}
+	return r.Err != nil && !errors.Is(r.Err, context.Canceled)
+}
+
+// observe records r and returns the pool size to use next, given the
+// current size and the number of queued URLs.
+func (a *aimd) observe(r Result, size, queued int) int {
+	if r.Skipped != "" {
+		return size
+	}
+	a.n++
+	if overloaded(r) {
+		a.overload++
+	}
+	if r.Page != nil {
+		a.total += r.Page.Elapsed
+	}
+	if a.n < a.window {
+		return size
+	}
+
+	errorRate := float64(a.overload) / float64(a.n)
+	mean := a.total / time.Duration(a.n)
+	a.n, a.overload, a.total = 0, 0, 0
+
+	switch {
+	case errorRate > a.maxErrorRate:
+		return max(size/2, a.min)
+	case mean < a.latency && queued > 0:
+		return min(size+1, a.max)
+	}
+	return max(min(size, a.max), a.min)
+}
@@ -0,0 +1,151 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAIMD(t *testing.T) {
+	a := newAIMD(Config{MinWorkers: 2, MaxWorkers: 5, ScaleLatency: time.Second})
+	fast := Result{Page: &Page{StatusCode: 200, Elapsed: 10 * time.Millisecond}}
+	slow := Result{Page: &Page{StatusCode: 200, Elapsed: 2 * time.Second}}
+	limited := Result{Page: &Page{StatusCode: 429}}
+
+	size := 2
+	steps := []struct {
+		name        string
+		queued, bad int
+		r           Result
+		want        int
+	}{
+		{"fast with a queue grows", 10, 0, fast, 3},
+		{"keeps growing", 10, 0, fast, 4},
+		{"no queue holds", 0, 0, fast, 4},
+		{"slow holds", 10, 0, slow, 4},
+		{"one 429 in ten is tolerated", 10, 1, fast, 5},
+		{"capped at max", 10, 0, fast, 5},
+		{"429s halve", 10, 3, fast, 2},
+		{"floored at min", 10, 5, fast, 2},
+	}
+	for _, s := range steps {
+		for i := range a.window {
+			r := s.r
+			if i < s.bad {
+				r = limited
+			}
+			got := a.observe(r, size, s.queued)
+			if i < a.window-1 && got != size {
+				t.Fatalf("%s: resized to %d before the window was full", s.name, got)
+			}
+			if i == a.window-1 {
+				size = got
+			}
+		}
+		if size != s.want {
+			t.Errorf("%s: got %d workers want %d", s.name, size, s.want)
+		}
+	}
+}
+
+func TestPoolResize(t *testing.T) {
+	var mu sync.Mutex
+	running := make(map[int]bool)
+	var wg sync.WaitGroup
+	p := newPool(func(id int, quit <-chan struct{}) {
+		mu.Lock()
+		running[id] = true
+		mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-quit
+			mu.Lock()
+			delete(running, id)
+			mu.Unlock()
+		}()
+	})
+
+	p.resize(4)
+	p.resize(2)
+	p.resize(3)
+	if p.size() != 3 {
+		t.Fatalf("got size %d want 3", p.size())
+	}
+	p.resize(0)
+	wg.Wait()
+	if len(running) != 0 {
+		t.Errorf("workers still running: %v", running)
+	}
+}
+
+func TestCrawlScalesWorkers(t *testing.T) {
+	responses := map[string][]fakeResponse{}
+	var links strings.Builder
+	for i := range 60 {
+		u := fmt.Sprintf("%s/p%d", site, i)
+		fmt.Fprintf(&links, `<a href="%s">%d</a>`, u, i)
+		// Half the links fail, so every window of results is over the
+		// error rate and the pool should halve down to MinWorkers.
+		if i%2 == 0 {
+			responses[u] = []fakeResponse{{Err: errors.New("connection reset"), Delay: 2 * time.Millisecond}}
+		} else {
+			responses[u] = []fakeResponse{{Body: "ok", Delay: 2 * time.Millisecond}}
+		}
+	}
+	responses[site+"/"] = fakeHTML(links.String())
+
+	var mu sync.Mutex
+	maxInflight, inflight := 0, 0
+	var started []int // how many fetches were in flight as each one started
+	f := newFakeFetcher(responses)
+	counting := fetcherFunc(func(ctx context.Context, url string) (*Page, error) {
+		mu.Lock()
+		inflight++
+		maxInflight = max(maxInflight, inflight)
+		started = append(started, inflight)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inflight--
+			mu.Unlock()
+		}()
+		return f.Fetch(ctx, url)
+	})
+
+	cfg := Config{MaxDepth: 1, Workers: 4, MinWorkers: 1, MaxWorkers: 8, IgnoreRobots: true}
+	c := newTestCrawler(cfg, counting)
+	var results int
+	c.Run(context.Background(), func(Result) { results++ })
+
+	if results != 61 {
+		t.Errorf("got %d results want 61", results)
+	}
+	if maxInflight > 8 {
+		t.Errorf("%d fetches in flight, above MaxWorkers", maxInflight)
+	}
+	// The pool starts at four workers and, after two windows of ten
+	// results, is down to one, so the last fetches never overlap.
+	if early := slices.Max(started[:10]); early < 2 {
+		t.Errorf("at most %d fetch in flight early on, want the four workers overlapping", early)
+	}
+	if late := slices.Max(started[40:]); late != 1 {
+		t.Errorf("%d fetches in flight late in the crawl, want the pool shrunk to one: %v", late, started)
+	}
+	var out bytes.Buffer
+	c.metrics.writeTo(&out)
+	if n := strings.Count(out.String(), "crawler_inflight_requests{"); n != 0 {
+		t.Errorf("%d workers still reported after the crawl", n)
+	}
+}
+
+// fetcherFunc adapts a function to Fetcher.
+type fetcherFunc func(ctx context.Context, url string) (*Page, error)
+
+func (f fetcherFunc) Fetch(ctx context.Context, url string) (*Page, error) { return f(ctx, url) }
@@ -0,0 +1,196 @@
+package crawler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Record is the flat, serializable form of a Result that sinks write.
+type Record struct {
+	Worker    int     `json:"worker"`
+	URL       string  `json:"url"`
+	Status    int     `json:"status,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	Limit     string  `json:"limit,omitempty"`
+	Skipped   string  `json:"skipped,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+	Bytes     int     `json:"bytes"`
+	Depth     int     `json:"depth"`
+	Parent    string  `json:"parent,omitempty"`
+	Attempts  int     `json:"attempts"`
+	CacheHit  bool    `json:"cache_hit,omitempty"`
+
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+
+	Content *Content `json:"content,omitempty"` // only written as JSON
+}
+
+// NewRecord flattens r into a Record.
+func NewRecord(r Result) Record {
+	rec := Record{
+		Worker:   r.Worker,
+		URL:      r.URL,
+		Skipped:  r.Skipped,
+		Limit:    r.Limit,
+		Depth:    r.Depth,
+		Parent:   r.Parent,
+		Attempts: r.Attempts,
+		Content:  r.Content,
+
+		DuplicateOf: r.DuplicateOf,
+	}
+	if r.Page != nil {
+		rec.Status = r.Page.StatusCode
+		rec.LatencyMS = float64(r.Page.Elapsed) / float64(time.Millisecond)
+		rec.Bytes = len(r.Page.Body)
+		rec.CacheHit = r.Page.FromCache
+	}
+	if r.Err != nil {
+		rec.Error = r.Err.Error()
+	}
+	return rec
+}
+
+// Sink receives records as results arrive. Close flushes anything
+// buffered; it does not close the underlying writer.
+type Sink interface {
+	Write(Record) error
+	Close() error
+}
+
+// OutputFormats are the formats NewSink accepts.
+var OutputFormats = []string{"text", "table", "jsonl", "csv"}
+
+// NewSink returns the sink for one of OutputFormats writing to w.
+func NewSink(format string, w io.Writer) (Sink, error) {
+	switch format {
+	case "text":
+		return &textSink{w: w}, nil
+	case "table":
+		return &tableSink{w: w}, nil
+	case "jsonl":
+		return &jsonlSink{enc: json.NewEncoder(w)}, nil
+	case "csv":
+		return &csvSink{w: csv.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+// textSink prints one friendly line per result.
+type textSink struct {
+	w io.Writer
+}
+
+func (s *textSink) Write(r Record) error {
+	var err error
+	switch {
+	case r.Error != "" && r.Limit != "":
+		_, err = fmt.Fprintf(s.w, "❌ Worker %d %s error (%s limit): %s\n", r.Worker, r.URL, r.Limit, r.Error)
+	case r.Error != "":
+		_, err = fmt.Fprintf(s.w, "❌ Worker %d %s error: %s\n", r.Worker, r.URL, r.Error)
+	case r.Skipped != "":
+		_, err = fmt.Fprintf(s.w, "⏭️  Worker %d %s skipped: %s\n", r.Worker, r.URL, r.Skipped)
+	case r.DuplicateOf != "":
+		_, err = fmt.Fprintf(s.w, "✅ Worker %d %s -> %d, duplicate of %s\n", r.Worker, r.URL, r.Status, r.DuplicateOf)
+	default:
+		_, err = fmt.Fprintf(s.w, "✅ Worker %d %s -> %d\n", r.Worker, r.URL, r.Status)
+	}
+	return err
+}
+
+func (s *textSink) Close() error { return nil }
+
+// tableSink prints fixed-width columns. Widths are fixed up front
+// (rather than measured with text/tabwriter) so rows can be written as
+// soon as they arrive.
+type tableSink struct {
+	w       io.Writer
+	started bool
+}
+
+const tableRow = "%-6s %-6s %9s %9s %5s %-s\n"
+
+func (s *tableSink) Write(r Record) error {
+	if !s.started {
+		s.started = true
+		if _, err := fmt.Fprintf(s.w, tableRow, "WORKER", "STATUS", "LATENCY", "BYTES", "DEPTH", "URL"); err != nil {
+			return err
+		}
+	}
+
+	status := strconv.Itoa(r.Status)
+	url := r.URL
+	switch {
+	case r.Error != "" && r.Limit != "":
+		status = "ERR"
+		url += "  (" + r.Limit + " limit: " + r.Error + ")"
+	case r.Error != "":
+		status = "ERR"
+		url += "  (" + r.Error + ")"
+	case r.Skipped != "":
+		status = "SKIP"
+		url += "  (" + r.Skipped + ")"
+	case r.DuplicateOf != "":
+		url += "  (duplicate of " + r.DuplicateOf + ")"
+	}
+	latency := time.Duration(r.LatencyMS * float64(time.Millisecond)).Round(time.Millisecond)
+
+	_, err := fmt.Fprintf(s.w, tableRow,
+		strconv.Itoa(r.Worker), status, latency, strconv.Itoa(r.Bytes), strconv.Itoa(r.Depth), url)
+	return err
+}
+
+func (s *tableSink) Close() error { return nil }
+
+// jsonlSink writes one JSON object per line, ready for jq.
+type jsonlSink struct {
+	enc *json.Encoder
+}
+
+func (s *jsonlSink) Write(r Record) error { return s.enc.Encode(r) }
+func (s *jsonlSink) Close() error         { return nil }
+
+// csvSink writes a header row followed by one row per record. Each row
+// is flushed immediately so the file can be tailed.
+type csvSink struct {
+	w       *csv.Writer
+	started bool
+}
+
+var csvHeader = []string{"worker", "url", "status", "error", "limit", "skipped", "latency_ms", "bytes", "depth", "parent", "attempts", "cache_hit", "duplicate_of"}
+
+func (s *csvSink) Write(r Record) error {
+	if !s.started {
+		s.started = true
+		if err := s.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+
+	s.w.Write([]string{
+		strconv.Itoa(r.Worker),
+		r.URL,
+		strconv.Itoa(r.Status),
+		r.Error,
+		r.Limit,
+		r.Skipped,
+		strconv.FormatFloat(r.LatencyMS, 'f', 1, 64),
+		strconv.Itoa(r.Bytes),
+		strconv.Itoa(r.Depth),
+		r.Parent,
+		strconv.Itoa(r.Attempts),
+		strconv.FormatBool(r.CacheHit),
+		r.DuplicateOf,
+	})
+	s.w.Flush()
+	return s.w.Error()
+}
+
+func (s *csvSink) Close() error {
+	s.w.Flush()
+	return s.w.Error()
+}
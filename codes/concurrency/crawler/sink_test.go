@@ -0,0 +1,79 @@
+package crawler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewRecord(t *testing.T) {
+	rec := NewRecord(Result{
+		Worker:   2,
+		URL:      "https://example.com/a",
+		Depth:    1,
+		Parent:   "https://example.com/",
+		Attempts: 1,
+		Page:     &Page{StatusCode: http.StatusOK, Body: []byte("hello"), Elapsed: 1500 * time.Microsecond},
+	})
+
+	if rec.Status != 200 || rec.Bytes != 5 || rec.LatencyMS != 1.5 || rec.Parent != "https://example.com/" {
+		t.Errorf("got %+v", rec)
+	}
+}
+
+func TestSinks(t *testing.T) {
+	records := []Record{
+		{Worker: 1, URL: "https://example.com/", Status: 200, Bytes: 10, Attempts: 1, CacheHit: true},
+		NewRecord(Result{Worker: 2, URL: "https://example.com/x", Err: errors.New("boom"), Attempts: 3}),
+		{Worker: 1, URL: "https://example.com/copy", Status: 200, Bytes: 10, Attempts: 1, DuplicateOf: "https://example.com/"},
+		{Worker: 3, URL: "https://example.com/slow", Error: "ttfb limit of 1s exceeded", Limit: LimitFirstByte, Attempts: 1},
+	}
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{"jsonl", []string{
+			`{"worker":1,"url":"https://example.com/","status":200,"latency_ms":0,"bytes":10,"depth":0,"attempts":1,"cache_hit":true}`,
+			`{"worker":2,"url":"https://example.com/x","error":"boom","latency_ms":0,"bytes":0,"depth":0,"attempts":3}`,
+			`{"worker":1,"url":"https://example.com/copy","status":200,"latency_ms":0,"bytes":10,"depth":0,"attempts":1,"duplicate_of":"https://example.com/"}`,
+			`{"worker":3,"url":"https://example.com/slow","error":"ttfb limit of 1s exceeded","limit":"ttfb","latency_ms":0,"bytes":0,"depth":0,"attempts":1}`,
+		}},
+		{"csv", []string{
+			"worker,url,status,error,limit,skipped,latency_ms,bytes,depth,parent,attempts,cache_hit,duplicate_of",
+			"1,https://example.com/,200,,,,0.0,10,0,,1,true,",
+			"2,https://example.com/x,0,boom,,,0.0,0,0,,3,false,",
+			"1,https://example.com/copy,200,,,,0.0,10,0,,1,false,https://example.com/",
+			"3,https://example.com/slow,0,ttfb limit of 1s exceeded,ttfb,,0.0,0,0,,1,false,",
+		}},
+		{"text", []string{
+			"✅ Worker 1 https://example.com/ -> 200",
+			"❌ Worker 2 https://example.com/x error: boom",
+			"✅ Worker 1 https://example.com/copy -> 200, duplicate of https://example.com/",
+			"❌ Worker 3 https://example.com/slow error (ttfb limit): ttfb limit of 1s exceeded",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out strings.Builder
+			sink, err := NewSink(tt.format, &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range records {
+				if err := sink.Write(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sink.Close()
+
+			got := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
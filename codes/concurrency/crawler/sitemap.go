@@ -0,0 +1,239 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSitemaps caps how many sitemap files one crawl will read, so a
+// runaway sitemap index can't keep the crawler busy forever.
+const maxSitemaps = 1000
+
+// MaxSitemapSize is the largest sitemap the protocol allows, 50 MB
+// uncompressed. It caps the download and, for a gzipped sitemap, what
+// it unpacks to; Config.MaxBodySize doesn't apply to sitemaps.
+const MaxSitemapSize = 50 << 20
+
+// sitemapURL is one <url> (or, in an index, one <sitemap>) entry.
+type sitemapURL struct {
+	Loc      string
+	LastMod  time.Time
+	Priority float64 // 0.0 to 1.0; 0.5 when not given
+}
+
+// sitemap is a parsed sitemap file. Exactly one of URLs and Sitemaps is
+// set, depending on whether the file was a <urlset> or <sitemapindex>.
+type sitemap struct {
+	URLs     []sitemapURL
+	Sitemaps []sitemapURL
+}
+
+type xmlSitemapEntry struct {
+	Loc      string `xml:"loc"`
+	LastMod  string `xml:"lastmod"`
+	Priority string `xml:"priority"`
+}
+
+// parseSitemap reads a sitemap or sitemap index, gunzipping it first if
+// it is gzip-compressed. A gzipped sitemap that unpacks to more than
+// maxSize bytes is an error.
+func parseSitemap(data []byte, maxSize int64) (*sitemap, error) {
+	var r io.Reader = bytes.NewReader(data)
+	var unpacked *sizeCapReader
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		unpacked = &sizeCapReader{r: gz, n: maxSize}
+		r = unpacked
+	}
+
+	var doc struct {
+		XMLName  xml.Name
+		URLs     []xmlSitemapEntry `xml:"url"`
+		Sitemaps []xmlSitemapEntry `xml:"sitemap"`
+	}
+	err := xml.NewDecoder(r).Decode(&doc)
+	if unpacked != nil && unpacked.n < 0 {
+		// The decoder may have finished on bytes read past the cap.
+		return nil, errSitemapTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sm := &sitemap{}
+	switch doc.XMLName.Local {
+	case "urlset":
+		sm.URLs = convertSitemapEntries(doc.URLs)
+	case "sitemapindex":
+		sm.Sitemaps = convertSitemapEntries(doc.Sitemaps)
+	default:
+		return nil, fmt.Errorf("not a sitemap: root element <%s>", doc.XMLName.Local)
+	}
+	return sm, nil
+}
+
+// sizeCapReader reads from r until more than n bytes have come out,
+// then fails with an error instead of handing over a cut-off document.
+type sizeCapReader struct {
+	r io.Reader
+	n int64 // bytes left before the cap
+}
+
+func (s *sizeCapReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > s.n+1 {
+		p = p[:s.n+1]
+	}
+	n, err := s.r.Read(p)
+	if s.n -= int64(n); s.n < 0 {
+		return n, errSitemapTooLarge
+	}
+	return n, err
+}
+
+var errSitemapTooLarge = errors.New("sitemap too large")
+
+func convertSitemapEntries(entries []xmlSitemapEntry) []sitemapURL {
+	var out []sitemapURL
+	for _, e := range entries {
+		loc := strings.TrimSpace(e.Loc)
+		if loc == "" {
+			continue
+		}
+		u := sitemapURL{Loc: loc, Priority: 0.5}
+		u.LastMod, _ = parseLastMod(e.LastMod)
+		if p, err := strconv.ParseFloat(strings.TrimSpace(e.Priority), 64); err == nil && p >= 0 && p <= 1 {
+			u.Priority = p
+		}
+		out = append(out, u)
+	}
+	return out
+}
+
+// parseLastMod accepts the W3C datetime forms sitemaps use.
+func parseLastMod(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("bad lastmod: " + s)
+}
+
+// sitemapBatch is what discovery sends back to the coordinator: the
+// URLs from one sitemap file, or the error reading it.
+type sitemapBatch struct {
+	Source string
+	Jobs   []Job
+	Err    error
+}
+
+// discoverSitemaps reads the sitemaps given in cfg.Sitemaps and, with
+// cfg.SitemapDiscovery, those listed in each seed host's robots.txt.
+// Index files are followed. Every file read is reported on out, which
+// is closed when discovery is done.
+func (c *Crawler) discoverSitemaps(ctx context.Context, out chan<- sitemapBatch) {
+	defer close(out)
+
+	todo := append([]string(nil), c.cfg.Sitemaps...)
+	if c.cfg.SitemapDiscovery {
+		// With IgnoreRobots there is no cache yet, but robots.txt is
+		// still where the sitemaps are listed.
+		robots := c.robots
+		if robots == nil {
+			robots = newRobotsCache(retryingFetcher{c}, c.cfg.UserAgent)
+		}
+		for _, seed := range c.cfg.Seeds {
+			u, err := url.Parse(seed)
+			if err != nil {
+				continue
+			}
+			found, err := robots.Sitemaps(ctx, u)
+			if err == nil {
+				todo = append(todo, found...)
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for len(todo) > 0 && len(seen) < maxSitemaps {
+		loc := todo[0]
+		todo = todo[1:]
+		if seen[loc] {
+			continue
+		}
+		seen[loc] = true
+
+		batch := sitemapBatch{Source: loc}
+		sm, err := c.fetchSitemap(ctx, loc)
+		if err != nil {
+			batch.Err = err
+		} else {
+			for _, s := range sm.Sitemaps {
+				todo = append(todo, s.Loc)
+			}
+			batch.Jobs = sitemapJobs(loc, sm.URLs)
+		}
+
+		select {
+		case out <- batch:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// fetchSitemap reads one sitemap file. Discovery runs beside the
+// workers, so it waits its turn with the scheduler like they do, and
+// retries like they do.
+func (c *Crawler) fetchSitemap(ctx context.Context, loc string) (*sitemap, error) {
+	host := hostOf(loc)
+	if err := c.sched.wait(ctx, host); err != nil {
+		return nil, err
+	}
+	var r Result
+	c.retryFetch(ctx, c.sitemapFetcher, loc, &r)
+	c.release(Result{URL: loc})
+
+	page := r.Page
+	if page == nil {
+		return nil, r.Err
+	}
+	if page.StatusCode != 200 {
+		return nil, &statusError{StatusCode: page.StatusCode, Status: page.Status}
+	}
+	if page.Truncated {
+		return nil, errSitemapTooLarge
+	}
+	return parseSitemap(page.Body, MaxSitemapSize)
+}
+
+// sitemapJobs turns sitemap entries into seed-level jobs, most
+// important first: higher priority, then more recently modified.
+func sitemapJobs(source string, urls []sitemapURL) []Job {
+	jobs := make([]Job, 0, len(urls))
+	for _, u := range urls {
+		jobs = append(jobs, Job{URL: u.Loc, Parent: source, Sitemap: true, Priority: u.Priority, LastMod: u.LastMod})
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		if jobs[i].Priority != jobs[j].Priority {
+			return jobs[i].Priority > jobs[j].Priority
+		}
+		return jobs[i].LastMod.After(jobs[j].LastMod)
+	})
+	return jobs
+}
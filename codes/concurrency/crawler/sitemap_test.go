@@ -0,0 +1,177 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testURLSet = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://site.test/old</loc><lastmod>2020-01-01</lastmod></url>
+  <url><loc>https://site.test/new</loc><lastmod>2024-05-01T10:00:00+00:00</lastmod></url>
+  <url><loc>https://site.test/important</loc><priority>0.9</priority></url>
+</urlset>`
+
+const testIndex = `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>https://site.test/sitemap-pages.xml.gz</loc></sitemap>
+</sitemapindex>`
+
+func gzipped(t *testing.T, s string) string {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(s))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestParseSitemap(t *testing.T) {
+	sm, err := parseSitemap([]byte(gzipped(t, testURLSet)), MaxSitemapSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sm.URLs) != 3 || len(sm.Sitemaps) != 0 {
+		t.Fatalf("got %+v", sm)
+	}
+	if got := sm.URLs[0].LastMod; !got.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("got lastmod %v", got)
+	}
+	if sm.URLs[0].Priority != 0.5 || sm.URLs[2].Priority != 0.9 {
+		t.Errorf("got priorities %v and %v", sm.URLs[0].Priority, sm.URLs[2].Priority)
+	}
+
+	index, err := parseSitemap([]byte(testIndex), MaxSitemapSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Sitemaps) != 1 || len(index.URLs) != 0 {
+		t.Errorf("got %+v", index)
+	}
+
+	if _, err := parseSitemap([]byte("<html></html>"), MaxSitemapSize); err == nil {
+		t.Errorf("an HTML page should not parse as a sitemap")
+	}
+}
+
+func TestSitemapJobsOrder(t *testing.T) {
+	sm, _ := parseSitemap([]byte(testURLSet), MaxSitemapSize)
+	jobs := sitemapJobs("https://site.test/sitemap.xml", sm.URLs)
+
+	want := []string{"https://site.test/important", "https://site.test/new", "https://site.test/old"}
+	for i, j := range jobs {
+		if j.URL != want[i] {
+			t.Errorf("position %d: got %s want %s", i, j.URL, want[i])
+		}
+	}
+}
+
+func TestCrawlSeedsFromRobotsSitemaps(t *testing.T) {
+	f := newFakeFetcher(map[string][]fakeResponse{
+		site + "/robots.txt":           {{Body: "Sitemap: https://site.test/sitemap.xml\n"}},
+		site + "/sitemap.xml":          {{Body: testIndex}},
+		site + "/sitemap-pages.xml.gz": {{Body: gzipped(t, testURLSet), Header: http.Header{"Content-Type": {"application/gzip"}}}},
+		site + "/":                     fakeHTML("home"),
+		site + "/important":            fakeHTML("important"),
+		site + "/new":                  fakeHTML("new"),
+		site + "/old":                  fakeHTML("old"),
+	})
+
+	// Ignoring robots.txt rules doesn't stop it listing sitemaps.
+	for _, ignore := range []bool{false, true} {
+		var urls []string
+		newTestCrawler(Config{Workers: 1, SitemapDiscovery: true, IgnoreRobots: ignore}, f).Run(context.Background(), func(r Result) {
+			if r.Err != nil {
+				t.Errorf("%s: %v", r.URL, r.Err)
+			}
+			urls = append(urls, r.URL)
+		})
+
+		if len(urls) != 4 {
+			t.Errorf("ignore robots %v: got %v, want the seed and three sitemap URLs", ignore, urls)
+		}
+	}
+}
+
+func TestParseSitemapGzipCap(t *testing.T) {
+	data := []byte(gzipped(t, testURLSet))
+	if _, err := parseSitemap(data, int64(len(testURLSet))); err != nil {
+		t.Errorf("sitemap at the cap: %v", err)
+	}
+	if _, err := parseSitemap(data, int64(len(testURLSet))-1); !errors.Is(err, errSitemapTooLarge) {
+		t.Errorf("sitemap over the cap: got %v want errSitemapTooLarge", err)
+	}
+}
+
+func TestFetchSitemapSize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testURLSet)
+	}))
+	defer ts.Close()
+
+	// Sitemaps aren't cut off at the page size cap...
+	c := New(Config{MaxBodySize: 100, Client: ts.Client()})
+	if sm, err := c.fetchSitemap(context.Background(), ts.URL); err != nil || len(sm.URLs) != 3 {
+		t.Fatalf("got %+v, %v", sm, err)
+	}
+
+	// ...but one over their own cap is an error, not a partial list.
+	c.sitemapFetcher = newHTTPFetcher(ts.Client(), "", 100)
+	if _, err := c.fetchSitemap(context.Background(), ts.URL); !errors.Is(err, errSitemapTooLarge) {
+		t.Errorf("got %v want errSitemapTooLarge", err)
+	}
+}
+
+func TestSitemapFetchesArePolite(t *testing.T) {
+	var index strings.Builder
+	index.WriteString(`<sitemapindex>`)
+	responses := map[string][]fakeResponse{site + "/": fakeHTML("home")}
+	for _, name := range []string{"a", "b", "c"} {
+		fmt.Fprintf(&index, `<sitemap><loc>%s/sitemap-%s.xml</loc></sitemap>`, site, name)
+		responses[site+"/sitemap-"+name+".xml"] = []fakeResponse{{Body: `<urlset><url><loc>` + site + "/" + name + `</loc></url></urlset>`}}
+		responses[site+"/"+name] = fakeHTML(name)
+	}
+	index.WriteString(`</sitemapindex>`)
+	responses[site+"/sitemap.xml"] = []fakeResponse{{Status: http.StatusServiceUnavailable}, {Body: index.String()}}
+	f := newFakeFetcher(responses)
+
+	var mu sync.Mutex
+	var starts []time.Time
+	timed := fetcherFunc(func(ctx context.Context, url string) (*Page, error) {
+		mu.Lock()
+		starts = append(starts, time.Now())
+		mu.Unlock()
+		return f.Fetch(ctx, url)
+	})
+
+	cfg := Config{Sitemaps: []string{site + "/sitemap.xml"}, IgnoreRobots: true, MaxAttempts: 2, HostRequestsPerSecond: 20}
+	var urls []string
+	newTestCrawler(cfg, timed).Run(context.Background(), func(r Result) {
+		if r.Err != nil {
+			t.Errorf("%s: %v", r.URL, r.Err)
+		}
+		urls = append(urls, r.URL)
+	})
+
+	// The index needed a retry, and every sitemap and page is fetched.
+	if f.Calls(site+"/sitemap.xml") != 2 || len(urls) != 4 {
+		t.Errorf("index fetched %d times, results %v", f.Calls(site+"/sitemap.xml"), urls)
+	}
+	// Pages and sitemaps, retries included, share the host's 20 per
+	// second. The coordinator and discovery can both take the first
+	// token, leaving the bucket in debt, so allow one fetch of slack.
+	if spread, want := starts[len(starts)-1].Sub(starts[0]), time.Duration(len(starts)-2)*45*time.Millisecond; spread < want {
+		t.Errorf("%d fetches took %v, want at least %v", len(starts), spread, want)
+	}
+}
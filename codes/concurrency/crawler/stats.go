@@ -0,0 +1,255 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// stats collects crawl statistics. It is safe for concurrent use, so a
+// snapshot can be taken while the crawl is still running.
+type stats struct {
+	mu sync.Mutex
+
+	start    time.Time
+	interval time.Duration // width of each throughput bucket
+
+	pages     int
+	failed    int
+	skipped   int
+	bytes     int64
+	cacheHits int
+	byStatus  map[string]int // "2xx", "4xx", ...
+	byError   map[string]int // see errorKind
+	byHost    map[string]int
+	latency   *histogram // seconds, in statsLatencyBuckets
+	perBucket []int      // results finished in each interval since start
+
+	now func() time.Time
+}
+
+// statsLatencyBuckets bound the histogram the latency percentiles come
+// from: 10% apart from 1ms to about two minutes, so a percentile is off
+// by at most a tenth however long the crawl runs.
+var statsLatencyBuckets = exponentialBuckets(0.001, 1.1, 124)
+
+func newStats(interval time.Duration) *stats {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return &stats{
+		start:    time.Now(),
+		interval: interval,
+		byStatus: make(map[string]int),
+		byError:  make(map[string]int),
+		byHost:   make(map[string]int),
+		latency:  newHistogram(statsLatencyBuckets),
+		now:      time.Now,
+	}
+}
+
+// record adds one result.
+func (s *stats) record(r Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket := int(s.now().Sub(s.start) / s.interval)
+	for len(s.perBucket) <= bucket {
+		s.perBucket = append(s.perBucket, 0)
+	}
+	s.perBucket[bucket]++
+
+	if host := hostOf(r.URL); host != "" {
+		s.byHost[host]++
+	}
+
+	switch {
+	case r.Skipped != "":
+		s.skipped++
+		return
+	case r.Err != nil:
+		s.failed++
+		s.byError[errorKind(r.Err)]++
+	}
+
+	if r.Page != nil {
+		// A response that still failed, like a 503 after the last
+		// retry, counts as failed but not as a page, as in Counters.
+		if r.Err == nil {
+			s.pages++
+		}
+		s.bytes += int64(len(r.Page.Body))
+		if r.Page.FromCache {
+			s.cacheHits++
+		}
+		s.byStatus[fmt.Sprintf("%dxx", r.Page.StatusCode/100)]++
+		s.latency.observe(r.Page.Elapsed.Seconds())
+	}
+}
+
+// errorKind buckets err into a short, stable label.
+func errorKind(err error) string {
+	var se *statusError
+	var le *limitError
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuth x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &se):
+		if se.StatusCode == 429 {
+			return "http 429"
+		}
+		return fmt.Sprintf("http %dxx", se.StatusCode/100)
+	case errors.As(err, &le):
+		return le.Limit + " timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection reset"
+	case errors.As(err, &certErr), errors.As(err, &unknownAuth), errors.As(err, &hostErr):
+		return "tls"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case strings.HasPrefix(err.Error(), "robots.txt:"):
+		return "robots.txt"
+	}
+	return "other"
+}
+
+// StatsSnapshot is a point-in-time copy of stats.
+type StatsSnapshot struct {
+	Elapsed       time.Duration
+	Pages         int // fetched without error, like Counters.Fetched
+	Failed        int
+	Skipped       int
+	Bytes         int64
+	CacheHits     int
+	ByStatus      map[string]int
+	ByError       map[string]int
+	ByHost        map[string]int
+	P50, P90, P99 time.Duration
+	Interval      time.Duration
+	PerInterval   []int
+}
+
+func (s *stats) snapshot() StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := StatsSnapshot{
+		Elapsed:     s.now().Sub(s.start),
+		Pages:       s.pages,
+		Failed:      s.failed,
+		Skipped:     s.skipped,
+		Bytes:       s.bytes,
+		CacheHits:   s.cacheHits,
+		ByStatus:    copyCounts(s.byStatus),
+		ByError:     copyCounts(s.byError),
+		ByHost:      copyCounts(s.byHost),
+		Interval:    s.interval,
+		PerInterval: append([]int(nil), s.perBucket...),
+	}
+
+	snap.P50 = seconds(s.latency.quantile(0.50))
+	snap.P90 = seconds(s.latency.quantile(0.90))
+	snap.P99 = seconds(s.latency.quantile(0.99))
+	return snap
+}
+
+func copyCounts(m map[string]int) map[string]int {
+	c := make(map[string]int, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// PagesPerSecond is the average throughput so far.
+func (s StatsSnapshot) PagesPerSecond() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Pages) / s.Elapsed.Seconds()
+}
+
+// ProgressLine is a one-line summary for periodic progress output.
+func (s StatsSnapshot) ProgressLine() string {
+	return fmt.Sprintf("[%s] %d pages, %d failed, %d skipped, %.1f pages/s, p50 %v",
+		s.Elapsed.Round(time.Second), s.Pages, s.Failed, s.Skipped, s.PagesPerSecond(), s.P50.Round(time.Millisecond))
+}
+
+// Print writes the end-of-crawl summary table.
+func (s StatsSnapshot) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintf(tw, "Duration\t%v\n", s.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(tw, "Pages fetched\t%d\n", s.Pages)
+	fmt.Fprintf(tw, "Failed\t%d\n", s.Failed)
+	fmt.Fprintf(tw, "Skipped\t%d\n", s.Skipped)
+	fmt.Fprintf(tw, "Bytes\t%d\n", s.Bytes)
+	if s.CacheHits > 0 {
+		fmt.Fprintf(tw, "Cache hits\t%d\n", s.CacheHits)
+	}
+	fmt.Fprintf(tw, "Throughput\t%.2f pages/s\n", s.PagesPerSecond())
+	fmt.Fprintf(tw, "Latency p50 / p90 / p99\t%v / %v / %v\n",
+		s.P50.Round(time.Millisecond), s.P90.Round(time.Millisecond), s.P99.Round(time.Millisecond))
+
+	printCounts(tw, "Status", s.ByStatus)
+	printCounts(tw, "Errors", s.ByError)
+	printCounts(tw, "Hosts", s.ByHost)
+
+	if len(s.PerInterval) > 1 {
+		fmt.Fprintf(tw, "Throughput per %v\t", s.Interval)
+		for i, n := range s.PerInterval {
+			if i > 0 {
+				fmt.Fprint(tw, " ")
+			}
+			fmt.Fprintf(tw, "%.1f", float64(n)/s.Interval.Seconds())
+		}
+		fmt.Fprintln(tw)
+	}
+}
+
+// printCounts writes a titled breakdown, largest count first.
+func printCounts(w io.Writer, title string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	fmt.Fprintf(w, "%s\t\n", title)
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %s\t%d\n", k, counts[k])
+	}
+}
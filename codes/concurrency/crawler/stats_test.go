@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStatsPercentiles(t *testing.T) {
+	s := newStats(time.Second)
+	if snap := s.snapshot(); snap.P50 != 0 {
+		t.Errorf("empty: got p50 %v want 0", snap.P50)
+	}
+	for i := 1; i <= 1000; i++ {
+		s.record(Result{URL: "https://a.test/", Page: &Page{StatusCode: 200, Elapsed: time.Duration(i) * time.Millisecond}})
+	}
+
+	snap := s.snapshot()
+	for _, p := range []struct {
+		got, want time.Duration
+	}{{snap.P50, 500 * time.Millisecond}, {snap.P90, 900 * time.Millisecond}, {snap.P99, 990 * time.Millisecond}} {
+		// The buckets are 10% wide.
+		if p.got < p.want*9/10 || p.got > p.want*11/10 {
+			t.Errorf("got %v want about %v", p.got, p.want)
+		}
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := newHistogram([]float64{1, 2, 4})
+	for _, v := range []float64{0.5, 1.5, 1.5, 3, 8} {
+		h.observe(v)
+	}
+	for q, want := range map[float64]float64{0.2: 1, 0.4: 1.5, 0.6: 2, 0.8: 4, 1: 4} {
+		if got := h.quantile(q); got != want {
+			t.Errorf("quantile(%v) = %v want %v", q, got, want)
+		}
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&statusError{StatusCode: 503}, "http 5xx"},
+		{&statusError{StatusCode: 429}, "http 429"},
+		{fmt.Errorf("get: %w", context.DeadlineExceeded), "timeout"},
+		{fmt.Errorf("get: %w", context.Canceled), "canceled"},
+		{&net.DNSError{Err: "no such host", Name: "x.invalid"}, "dns"},
+		{errors.New("something else"), "other"},
+	}
+
+	for _, tt := range tests {
+		if got := errorKind(tt.err); got != tt.want {
+			t.Errorf("errorKind(%v) = %q want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestStatsSnapshot(t *testing.T) {
+	s := newStats(time.Second)
+	s.record(Result{URL: "https://a.test/", Page: &Page{StatusCode: 200, Body: []byte("abc"), Elapsed: time.Millisecond}})
+	s.record(Result{URL: "https://a.test/x", Page: &Page{StatusCode: 503}, Err: &statusError{StatusCode: 503}})
+	s.record(Result{URL: "https://b.test/", Skipped: "disallowed"})
+
+	snap := s.snapshot()
+	if snap.Pages != 1 || snap.Failed != 1 || snap.Skipped != 1 || snap.Bytes != 3 {
+		t.Errorf("got %+v", snap)
+	}
+	if snap.ByStatus["2xx"] != 1 || snap.ByStatus["5xx"] != 1 || snap.ByHost["a.test"] != 2 || snap.ByError["http 5xx"] != 1 {
+		t.Errorf("got breakdowns %v %v %v", snap.ByStatus, snap.ByHost, snap.ByError)
+	}
+}
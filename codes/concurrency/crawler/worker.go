@@ -0,0 +1,103 @@
+package crawler
+
+import (
+	"context"
+	"net/url"
+	"sync"
+)
+
+// Result is the outcome of one URL, passed to Run's handle callback.
+type Result struct {
+	Worker  int
+	URL     string
+	Depth   int
+	Parent  string
+	Page    *Page
+	Links   []string
+	Anchors []Anchor // the links with their text and fragments
+	Skipped string   // why the URL was not fetched, e.g. a robots.txt rule
+	Err     error
+
+	Attempts      int     // fetches made, including retries
+	AttemptErrors []error // the error from each failed attempt, in order
+	Limit         string  // the time limit behind Err, e.g. LimitFirstByte
+
+	Content *Content // set by the extraction stage for HTML pages
+
+	// Set when Config.Duplicates is.
+	Hash        string // hex SHA-256 of the body
+	Simhash     uint64 // near-duplicate fingerprint of the text; 0 if too short
+	DuplicateOf string // earlier URL with the same or nearly the same content
+}
+
+func (c *Crawler) worker(
+	ctx context.Context,
+	id int,
+	jobs <-chan Job,
+	results chan<- Result,
+	quit <-chan struct{},
+	wg *sync.WaitGroup,
+) {
+	defer wg.Done()
+	c.metrics.addInflight(id, 0)
+	defer c.metrics.removeWorker(id)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-quit:
+			// The pool shrank; the job we were on is already reported.
+			return
+
+		case job, ok := <-jobs:
+			if !ok {
+				return
+			}
+
+			c.metrics.addInflight(id, 1)
+			r := c.process(ctx, id, job)
+			c.metrics.addInflight(id, -1)
+			results <- r
+		}
+	}
+}
+
+// process checks robots.txt, fetches job and extracts its links.
+func (c *Crawler) process(ctx context.Context, id int, job Job) Result {
+	r := Result{Worker: id, URL: job.URL, Depth: job.Depth, Parent: job.Parent}
+	if c.robots != nil {
+		ok, reason, err := c.robots.Allowed(ctx, job.URL)
+		if err != nil || !ok {
+			r.Skipped, r.Err = reason, err
+			return r
+		}
+	}
+
+	if job.CheckOnly {
+		c.checkLink(ctx, job.URL, job.Head, &r)
+		r.Limit = limitOf(r.Err)
+		return r
+	}
+	c.fetchWithRetry(ctx, job.URL, &r)
+	if r.Err != nil {
+		r.Limit = limitOf(r.Err)
+		return r
+	}
+	if c.cfg.Duplicates != "" && fingerprintable(r.Page) {
+		fingerprint(&r)
+	}
+
+	if r.Page.IsHTML() {
+		if base, err := url.Parse(r.Page.FinalURL); err == nil {
+			r.Anchors = extractAnchors(base, r.Page.Body)
+			r.Links = anchorURLs(r.Anchors, r.Page.FinalURL)
+		}
+	}
+	if link := redirectTarget(r.Page); link != "" {
+		// The redirect policy stopped here; crawl the target as a link.
+		r.Links = append(r.Links, link)
+	}
+	return r
+}